@@ -2,6 +2,7 @@ package describers
 
 import (
 	"context"
+	"github.com/opengovern/og-describer-template/discovery/pkg/models"
 	"github.com/opengovern/og-util/pkg/describe/enums"
 	"go.uber.org/zap"
 )
@@ -37,3 +38,16 @@ func GetLoggerFromContext(ctx context.Context) *zap.Logger {
 	}
 	return logger
 }
+
+// WithStats attaches the stats collector of the current describe. API calls
+// and rate limit waits made through models.StatsTransport are recorded on it,
+// describers add the pages they fetch.
+func WithStats(ctx context.Context, stats *models.DescribeStats) context.Context {
+	return models.ContextWithStats(ctx, stats)
+}
+
+// GetStatsFromContext returns the stats collector of the current describe, or
+// nil when there is none. A nil collector ignores updates.
+func GetStatsFromContext(ctx context.Context) *models.DescribeStats {
+	return models.StatsFromContext(ctx)
+}
@@ -21,13 +21,16 @@ func ListType(
 ) ([]models.Resource, error) {
 
 	var allValues []models.Resource
-	// TODO implement the logic to get the 
-	var resource *models.Resource
-	if stream != nil {
-				if err := (*stream)(*resource); err != nil {
-					return allValues, fmt.Errorf("error streaming resource: %w", err)
-				}
+	// TODO implement the logic to get the resources with client.HTTPClient,
+	// which records every API call in the describe stats. Record every
+	// fetched page with GetStatsFromContext(ctx).AddPage().
+	for _, resource := range allValues {
+		if stream != nil {
+			if err := (*stream)(resource); err != nil {
+				return allValues, fmt.Errorf("error streaming resource: %w", err)
 			}
+		}
+	}
 
 	// Return everything, even though we streamed each file already
 	return allValues, nil
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	configFile string
+	credFlags  []string
+	labelFlags []string
+)
+
+// localConfig is the --config file of the local commands, YAML or JSON:
+//
+//	credentials:
+//	  token: ...
+//	labels:
+//	  param: my-value
+type localConfig struct {
+	// Credentials are passed to provider.AccountCredentialsFromMap.
+	Credentials map[string]any `json:"credentials"`
+	// Labels become the integration labels of the describe job.
+	Labels map[string]string `json:"labels"`
+}
+
+// loadLocalConfig merges the --config file and the --cred and --label flags,
+// the flags taking precedence.
+func loadLocalConfig() (localConfig, error) {
+	cfg := localConfig{
+		Credentials: make(map[string]any),
+		Labels:      make(map[string]string),
+	}
+	if configFile != "" {
+		content, err := os.ReadFile(configFile)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read config file: %w", err)
+		}
+		var fileCfg localConfig
+		if err := yaml.Unmarshal(content, &fileCfg); err != nil {
+			return cfg, fmt.Errorf("failed to parse config file %s: %w", configFile, err)
+		}
+		for k, v := range fileCfg.Credentials {
+			cfg.Credentials[k] = v
+		}
+		for k, v := range fileCfg.Labels {
+			cfg.Labels[k] = v
+		}
+	}
+
+	for _, flag := range credFlags {
+		k, v, err := keyValue("--cred", flag)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Credentials[k] = v
+	}
+	for _, flag := range labelFlags {
+		k, v, err := keyValue("--label", flag)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Labels[k] = v
+	}
+	return cfg, nil
+}
+
+func keyValue(flag, value string) (string, string, error) {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(k) == "" {
+		return "", "", fmt.Errorf("%s expects key=value, got %q", flag, value)
+	}
+	return strings.TrimSpace(k), v, nil
+}
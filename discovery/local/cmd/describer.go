@@ -3,168 +3,102 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"github.com/opengovern/og-describer-template/global"
 	"github.com/opengovern/og-describer-template/global/constants"
+	"io"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/google/uuid"
-	model "github.com/opengovern/og-describer-template/discovery/pkg/models"
 	"github.com/opengovern/og-describer-template/discovery/pkg/orchestrator"
-	"github.com/opengovern/og-describer-template/discovery/provider"
 	"github.com/opengovern/og-util/pkg/describe"
-	"github.com/opengovern/og-util/pkg/es"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
 
 var (
-	resourceType string
-	outputFile   string
+	resourceType  string
+	resourceTypes []string
+	allTypes      bool
+	outputFile    string
+	outputDir     string
 )
 
+// describeResult is a row of the summary printed after describing.
+type describeResult struct {
+	ResourceType string
+	Count        int
+	Duration     time.Duration
+	Err          error
+}
+
 // describerCmd represents the describer command
 var describerCmd = &cobra.Command{
 	Use:   "describer",
-	Short: "A brief description of your command",
+	Short: "Describe one or more resource types and write the resources to files",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Environment takes priority
-		orgEnv := os.Getenv("GITHUB_ORG") //example parameter
-		patEnv := os.Getenv("GITHUB_PAT") //example  credential
-
-		if orgEnv != "" {
-			OrganizationName = orgEnv
-		}
-
-		if patEnv != "" {
-			PatToken = patEnv
-		}
-
-		// Open the output file
-		file, err := os.Create(outputFile)
-		if err != nil {
-			return fmt.Errorf("failed to create file: %w", err)
-		}
-		defer file.Close() // Ensure the file is closed at the end
-
-		job := describe.DescribeJob{
-			JobID:           uint(uuid.New().ID()),
-			ResourceType:    resourceType,
-			IntegrationID:   "",
-			ProviderID:      "",
-			DescribedAt:     time.Now().UnixMilli(),
-			IntegrationType: constants.IntegrationTypeLower,
-			CipherText:      "",
-			IntegrationLabels: map[string]string{
-				"OrganizationName": OrganizationName,
-			},
-			IntegrationAnnotations: nil,
-		}
-
-		ctx := context.Background()
-		logger, _ := zap.NewProduction()
-
-		creds, err := provider.AccountCredentialsFromMap(map[string]any{
-			"pat_token": PatToken,
-		})
+		cfg, err := loadLocalConfig()
 		if err != nil {
-			return fmt.Errorf(" account credentials: %w", err)
+			return err
 		}
 
-		additionalParameters, err := provider.GetAdditionalParameters(job)
+		types, err := selectedResourceTypes()
 		if err != nil {
 			return err
 		}
-		plg := global.Plugin()
-
-		f := func(resource model.Resource) error {
-			if resource.Description == nil {
-				return nil
-			}
-			descriptionJSON, err := json.Marshal(resource.Description)
-			if err != nil {
-				return fmt.Errorf("failed to marshal description: %w", err)
-			}
-			descriptionJSON, err = trimJsonFromEmptyObjects(descriptionJSON)
-			if err != nil {
-				return fmt.Errorf("failed to trim json: %w", err)
-			}
+		if len(types) == 0 {
+			return fmt.Errorf("no resource type to describe")
+		}
 
-			metadata, err := provider.GetResourceMetadata(job, resource)
-			if err != nil {
-				return fmt.Errorf("failed to get resource metadata")
+		var writer resourceWriter
+		if outputDir == "" {
+			if outputFormat == formatCSV && len(types) > 1 {
+				return fmt.Errorf("csv output of several resource types needs --outputDir")
 			}
-			err = provider.AdjustResource(job, &resource)
+			// Open the combined output file
+			out, err := createOutput(outputPath(outputFile, outputFormat))
 			if err != nil {
-				return fmt.Errorf("failed to adjust resource metadata")
+				return err
 			}
-
-			desc := resource.Description
-			err = json.Unmarshal(descriptionJSON, &desc)
+			defer out.Close() // Ensure the file is closed at the end
+			writer, err = newResourceWriter(outputFormat, out, types[0])
 			if err != nil {
-				return fmt.Errorf("unmarshal description: %v", err.Error())
+				return err
 			}
+		} else if err := os.MkdirAll(outputDir, 0o755); err != nil {
+			return fmt.Errorf("failed to create output dir: %w", err)
+		}
 
-			if plg != nil {
-				_, _, err = global.ExtractTagsAndNames(logger, plg, job.ResourceType, resource)
-				if err != nil {
-					logger.Error("failed to build tags for service", zap.Error(err), zap.String("resourceType", job.ResourceType), zap.Any("resource", resource))
-				}
-			}
+		ctx := context.Background()
+		logger, _ := zap.NewProduction()
 
-			var description any
-			err = json.Unmarshal([]byte(descriptionJSON), &description)
+		results := make([]describeResult, 0, len(types))
+		for _, rt := range types {
+			startedAt := time.Now()
+			count, err := describeToFile(ctx, logger, cfg, rt, writer)
+			results = append(results, describeResult{
+				ResourceType: rt,
+				Count:        count,
+				Duration:     time.Since(startedAt),
+				Err:          err,
+			})
 			if err != nil {
-				logger.Error("failed to parse resource description json", zap.Error(err))
-				return fmt.Errorf("failed to parse resource description json")
-			}
-
-			res := es.Resource{
-				PlatformID:      fmt.Sprintf("%s:::%s:::%s", job.IntegrationID, job.ResourceType, resource.UniqueID()),
-				ResourceID:      resource.UniqueID(),
-				ResourceName:    resource.Name,
-				Description:     description,
-				IntegrationType: constants.IntegrationName,
-				ResourceType:    strings.ToLower(job.ResourceType),
-				IntegrationID:   job.IntegrationID,
-				Metadata:        metadata,
-				DescribedAt:     job.DescribedAt,
-				DescribedBy:     strconv.FormatUint(uint64(job.JobID), 10),
+				logger.Error("failed to describe resource type", zap.String("resourceType", rt), zap.Error(err))
 			}
+		}
 
-			// Write the resource JSON to the file
-			resJSON, err := json.Marshal(res)
-			if err != nil {
-				return fmt.Errorf("failed to marshal resource JSON: %w", err)
-			}
-			_, err = file.Write(resJSON)
-			if err != nil {
-				return fmt.Errorf("failed to write to file: %w", err)
+		if writer != nil {
+			if err := writer.Close(); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
 			}
-			_, err = file.Write([]byte(",\n")) // Add a newline for readability
-			if err != nil {
-				return fmt.Errorf("failed to write newline to file: %w", err)
-			}
-
-			return nil
 		}
-		clientStream := (*model.StreamSender)(&f)
-
-		err = orchestrator.GetResources(
-			ctx,
-			logger,
-			job.ResourceType,
-			job.TriggerType,
-			creds,
-			additionalParameters,
-			clientStream,
-		)
-		if err != nil {
-			return err
+
+		failed := printSummary(cmd.ErrOrStderr(), results)
+		if failed > 0 {
+			return fmt.Errorf("%d of %d resource types failed", failed, len(results))
 		}
 		return nil
 	},
@@ -172,29 +106,91 @@ var describerCmd = &cobra.Command{
 
 func init() {
 	describerCmd.Flags().StringVar(&resourceType, "resourceType", "", "Resource type")
-	describerCmd.Flags().StringVar(&outputFile, "outputFile", "output.json", "File to write JSON outputs")
+	describerCmd.Flags().StringSliceVar(&resourceTypes, "resourceTypes", nil, "Resource types or globs on them, e.g. Github/Artifact/*, or tag patterns like category=artifact_*")
+	describerCmd.Flags().BoolVar(&allTypes, "all", false, "Describe every resource type")
+	describerCmd.Flags().StringVarP(&outputFile, "output", "o", "", "File to write the outputs to, - for stdout (default output.<format>)")
+	describerCmd.Flags().StringVar(&outputFile, "outputFile", "", "File to write the outputs to")
+	_ = describerCmd.Flags().MarkDeprecated("outputFile", "use --output instead")
+	describerCmd.Flags().StringVar(&outputDir, "outputDir", "", "Directory to write one file per resource type to, instead of output")
+	describerCmd.Flags().StringVar(&outputFormat, "format", formatJSON, "Output format: json, ndjson, yaml or csv")
 }
 
-func trimJsonFromEmptyObjects(input []byte) ([]byte, error) {
-	unknownData := map[string]any{}
-	err := json.Unmarshal(input, &unknownData)
-	if err != nil {
-		return nil, err
+// selectedResourceTypes returns the resource types chosen by --all,
+// --resourceTypes or --resourceType, in that order of precedence.
+func selectedResourceTypes() ([]string, error) {
+	switch {
+	case allTypes:
+		return orchestrator.ListResourceTypes(), nil
+	case len(resourceTypes) > 0:
+		types, err := orchestrator.SelectResourceTypes(resourceTypes, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(types) == 0 {
+			return nil, fmt.Errorf("no resource type matches %s", strings.Join(resourceTypes, ","))
+		}
+		return types, nil
+	case resourceType != "":
+		return []string{resourceType}, nil
+	default:
+		return nil, fmt.Errorf("one of --resourceType, --resourceTypes or --all is required")
 	}
-	trimEmptyMaps(unknownData)
-	return json.Marshal(unknownData)
 }
 
-func trimEmptyMaps(input map[string]any) {
-	for key, value := range input {
-		switch value.(type) {
-		case map[string]any:
-			if len(value.(map[string]any)) != 0 {
-				trimEmptyMaps(value.(map[string]any))
-			}
-			if len(value.(map[string]any)) == 0 {
-				delete(input, key)
+// describeToFile describes a single resource type and writes the resources
+// with writer, or to their own file under outputDir when writer is nil.
+func describeToFile(ctx context.Context, logger *zap.Logger, cfg localConfig, resourceType string, writer resourceWriter) (count int, err error) {
+	if writer == nil {
+		name := strings.ToLower(strings.ReplaceAll(resourceType, "/", "_")) + "." + strings.ToLower(outputFormat)
+		file, createErr := os.Create(filepath.Join(outputDir, name))
+		if createErr != nil {
+			return 0, fmt.Errorf("failed to create file: %w", createErr)
+		}
+		defer file.Close()
+		writer, err = newResourceWriter(outputFormat, file, resourceType)
+		if err != nil {
+			return 0, err
+		}
+		defer func() {
+			if closeErr := writer.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("failed to write output: %w", closeErr)
 			}
+		}()
+	}
+
+	job := describe.DescribeJob{
+		JobID:                  uint(uuid.New().ID()),
+		ResourceType:           resourceType,
+		IntegrationID:          "",
+		ProviderID:             "",
+		DescribedAt:            time.Now().UnixMilli(),
+		IntegrationType:        constants.IntegrationTypeLower,
+		CipherText:             "",
+		IntegrationLabels:      cfg.Labels,
+		IntegrationAnnotations: nil,
+	}
+
+	sink := &writerSink{writer: writer}
+	_, err = orchestrator.DescribeToSink(ctx, logger, job, localParams, cfg.Credentials, sink)
+	return sink.count, err
+}
+
+// printSummary writes a table of the results and returns the number of
+// failed resource types.
+func printSummary(out io.Writer, results []describeResult) int {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RESOURCE TYPE\tRESOURCES\tDURATION\tERROR")
+	failed, total := 0, 0
+	for _, r := range results {
+		errMsg := ""
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+			failed++
 		}
+		total += r.Count
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", r.ResourceType, r.Count, r.Duration.Round(time.Millisecond), errMsg)
 	}
+	fmt.Fprintf(w, "%d types, %d failed\t%d\t\t\n", len(results), failed, total)
+	w.Flush()
+	return failed
 }
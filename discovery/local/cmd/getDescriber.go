@@ -1,29 +1,18 @@
 package cmd
 
 import (
-	"encoding/json"
-	"fmt"
 	"github.com/google/uuid"
-	model "github.com/opengovern/og-describer-template/discovery/pkg/models"
 	"github.com/opengovern/og-describer-template/discovery/pkg/orchestrator"
-	"github.com/opengovern/og-describer-template/discovery/provider"
-	"github.com/opengovern/og-describer-template/global"
 	"github.com/opengovern/og-describer-template/global/constants"
 	"github.com/opengovern/og-util/pkg/describe"
-	"github.com/opengovern/og-util/pkg/es"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
-	"os"
-	"strconv"
-	"strings"
 	"time"
 )
 
 var (
-	resourceID       string
-	PatToken         = os.Getenv("PAT_TOKEN")         //example credes
-	OrganizationName = os.Getenv("ORGANIZATION_NAME") // example parameter
+	resourceID string
 )
 
 // getDescriberCmd represents the describer command
@@ -31,135 +20,51 @@ var getDescriberCmd = &cobra.Command{
 	Use:   "getDescriber",
 	Short: "A brief description of your command",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadLocalConfig()
+		if err != nil {
+			return err
+		}
+
 		// Open the output file
-		file, err := os.Create(outputFile)
+		file, err := createOutput(outputPath(outputFile, outputFormat))
 		if err != nil {
-			return fmt.Errorf("failed to create file: %w", err)
+			return err
 		}
 		defer file.Close() // Ensure the file is closed at the end
+		writer, err := newResourceWriter(outputFormat, file, resourceType)
+		if err != nil {
+			return err
+		}
 
 		job := describe.DescribeJob{
-			JobID:           uint(uuid.New().ID()),
-			ResourceType:    resourceType,
-			IntegrationID:   "",
-			ProviderID:      "",
-			DescribedAt:     time.Now().UnixMilli(),
-			IntegrationType: constants.IntegrationTypeLower,
-			CipherText:      "",
-			IntegrationLabels: map[string]string{
-				"OrganizationName": OrganizationName, // example parameter
-			},
+			JobID:                  uint(uuid.New().ID()),
+			ResourceType:           resourceType,
+			IntegrationID:          "",
+			ProviderID:             "",
+			DescribedAt:            time.Now().UnixMilli(),
+			IntegrationType:        constants.IntegrationTypeLower,
+			CipherText:             "",
+			IntegrationLabels:      cfg.Labels,
 			IntegrationAnnotations: nil,
 		}
 
 		ctx := context.Background()
 		logger, _ := zap.NewProduction()
 
-		creds, err := provider.AccountCredentialsFromMap(map[string]any{
-			"pat_token": PatToken,
-		})
-		if err != nil {
-			return fmt.Errorf(" account credentials: %w", err)
-		}
-
-		additionalParameters, err := provider.GetAdditionalParameters(job)
-		if err != nil {
-			return err
-		}
-		plg := global.Plugin()
-
-		f := func(resource model.Resource) error {
-			if resource.Description == nil {
-				return nil
-			}
-			descriptionJSON, err := json.Marshal(resource.Description)
-			if err != nil {
-				return fmt.Errorf("failed to marshal description: %w", err)
-			}
-			descriptionJSON, err = trimJsonFromEmptyObjects(descriptionJSON)
-			if err != nil {
-				return fmt.Errorf("failed to trim json: %w", err)
-			}
-
-			metadata, err := provider.GetResourceMetadata(job, resource)
-			if err != nil {
-				return fmt.Errorf("failed to get resource metadata")
-			}
-			err = provider.AdjustResource(job, &resource)
-			if err != nil {
-				return fmt.Errorf("failed to adjust resource metadata")
-			}
-
-			desc := resource.Description
-			err = json.Unmarshal(descriptionJSON, &desc)
-			if err != nil {
-				return fmt.Errorf("unmarshal description: %v", err.Error())
-			}
-
-			if plg != nil {
-				_, _, err = global.ExtractTagsAndNames(logger, plg, job.ResourceType, resource)
-				if err != nil {
-					logger.Error("failed to build tags for service", zap.Error(err), zap.String("resourceType", job.ResourceType), zap.Any("resource", resource))
-				}
-			}
-
-			var description any
-			err = json.Unmarshal([]byte(descriptionJSON), &description)
-			if err != nil {
-				logger.Error("failed to parse resource description json", zap.Error(err))
-				return fmt.Errorf("failed to parse resource description json")
-			}
-
-			res := es.Resource{
-				PlatformID:      fmt.Sprintf("%s:::%s:::%s", job.IntegrationID, job.ResourceType, resource.UniqueID()),
-				ResourceID:      resource.UniqueID(),
-				ResourceName:    resource.Name,
-				Description:     description,
-				IntegrationType: constants.IntegrationName,
-				ResourceType:    strings.ToLower(job.ResourceType),
-				IntegrationID:   job.IntegrationID,
-				Metadata:        metadata,
-				DescribedAt:     job.DescribedAt,
-				DescribedBy:     strconv.FormatUint(uint64(job.JobID), 10),
-			}
-
-			// Write the resource JSON to the file
-			resJSON, err := json.Marshal(res)
-			if err != nil {
-				return fmt.Errorf("failed to marshal resource JSON: %w", err)
-			}
-			_, err = file.Write(resJSON)
-			if err != nil {
-				return fmt.Errorf("failed to write to file: %w", err)
-			}
-			_, err = file.Write([]byte(",\n")) // Add a newline for readability
-			if err != nil {
-				return fmt.Errorf("failed to write newline to file: %w", err)
-			}
-
-			return nil
-		}
-		clientStream := (*model.StreamSender)(&f)
-
-		err = orchestrator.GetSingleResource(
-			ctx,
-			logger,
-			job.ResourceType,
-			job.TriggerType,
-			creds,
-			additionalParameters,
-			resourceID,
-			clientStream,
-		)
+		sink := &writerSink{writer: writer}
+		_, err = orchestrator.DescribeSingleToSink(ctx, logger, job, localParams, cfg.Credentials, resourceID, sink)
 		if err != nil {
 			return err
 		}
-		return nil
+		return writer.Close()
 	},
 }
 
 func init() {
 	getDescriberCmd.Flags().StringVar(&resourceType, "resourceType", "", "Resource type")
 	getDescriberCmd.Flags().StringVar(&resourceID, "resourceID", "", "Resource ID")
-	getDescriberCmd.Flags().StringVar(&outputFile, "outputFile", "output.json", "File to write JSON outputs")
+	getDescriberCmd.Flags().StringVarP(&outputFile, "output", "o", "", "File to write the output to, - for stdout (default output.<format>)")
+	getDescriberCmd.Flags().StringVar(&outputFile, "outputFile", "", "File to write the output to")
+	_ = getDescriberCmd.Flags().MarkDeprecated("outputFile", "use --output instead")
+	getDescriberCmd.Flags().StringVar(&outputFormat, "format", formatJSON, "Output format: json, ndjson, yaml or csv")
 }
@@ -0,0 +1,352 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/opengovern/og-describer-template/discovery/pkg/orchestrator"
+	"github.com/opengovern/og-describer-template/global"
+	"github.com/opengovern/og-util/pkg/es"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatYAML   = "yaml"
+	formatCSV    = "csv"
+
+	// stdioPath makes --output write to stdout and --input read from stdin.
+	stdioPath = "-"
+)
+
+var outputFormat string
+
+// localParams are the describe params of the local commands. A single batch
+// in flight keeps the output in the order the resources were described.
+var localParams = map[string]string{
+	"sink_max_in_flight": "1",
+}
+
+// resourceWriter writes described resources in one of the output formats.
+// Close completes the document, it does not close the underlying writer.
+type resourceWriter interface {
+	Write(resource es.Resource) error
+	Close() error
+}
+
+// newResourceWriter returns the writer of format, the csv columns being the
+// ones of the steampipe table of resourceType.
+func newResourceWriter(format string, w io.Writer, resourceType string) (resourceWriter, error) {
+	switch strings.ToLower(format) {
+	case formatJSON:
+		return &jsonWriter{w: w}, nil
+	case formatNDJSON:
+		return &ndjsonWriter{w: w}, nil
+	case formatYAML:
+		return &yamlWriter{w: w}, nil
+	case formatCSV:
+		columns, err := csvColumns(resourceType)
+		if err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: csv.NewWriter(w), columns: columns}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %s, expected json, ndjson, yaml or csv", format)
+	}
+}
+
+// outputPath returns path, or output.<format> when it is empty.
+func outputPath(path, format string) string {
+	if path != "" {
+		return path
+	}
+	return "output." + strings.ToLower(format)
+}
+
+// createOutput opens path for writing, stdout when path is "-".
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == stdioPath {
+		return nopCloser{os.Stdout}, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	return file, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// writerSink is an orchestrator.Sink writing the resource documents with a
+// resourceWriter, the lookup documents are skipped.
+type writerSink struct {
+	mu     sync.Mutex
+	writer resourceWriter
+	count  int
+}
+
+func (s *writerSink) Ingest(_ context.Context, docs []orchestrator.SinkDoc) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, doc := range docs {
+		if !doc.Resource || doc.Delete {
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(doc.Data))
+		decoder.UseNumber()
+		var resource es.Resource
+		if err := decoder.Decode(&resource); err != nil {
+			return fmt.Errorf("failed to decode resource: %w", err)
+		}
+		if err := s.writer.Write(resource); err != nil {
+			return err
+		}
+		s.count++
+	}
+	return nil
+}
+
+// Close leaves closing the writer to the command.
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// jsonWriter writes a JSON array with one resource per line.
+type jsonWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonWriter) Write(resource es.Resource) error {
+	resJSON, err := json.Marshal(resource)
+	if err != nil {
+		return fmt.Errorf("failed to marshal resource JSON: %w", err)
+	}
+	sep := ",\n"
+	if j.count == 0 {
+		sep = "[\n"
+	}
+	if _, err := io.WriteString(j.w, sep); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	if _, err := j.w.Write(resJSON); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	j.count++
+	return nil
+}
+
+func (j *jsonWriter) Close() error {
+	end := "\n]\n"
+	if j.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+// ndjsonWriter writes one JSON resource per line.
+type ndjsonWriter struct {
+	w io.Writer
+}
+
+func (n *ndjsonWriter) Write(resource es.Resource) error {
+	resJSON, err := json.Marshal(resource)
+	if err != nil {
+		return fmt.Errorf("failed to marshal resource JSON: %w", err)
+	}
+	if _, err := n.w.Write(append(resJSON, '\n')); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	return nil
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+// yamlWriter writes a YAML stream with one document per resource.
+type yamlWriter struct {
+	w io.Writer
+}
+
+func (y *yamlWriter) Write(resource es.Resource) error {
+	resYAML, err := yaml.Marshal(resource)
+	if err != nil {
+		return fmt.Errorf("failed to marshal resource YAML: %w", err)
+	}
+	if _, err := io.WriteString(y.w, "---\n"); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	if _, err := y.w.Write(resYAML); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	return nil
+}
+
+func (y *yamlWriter) Close() error {
+	return nil
+}
+
+// csvColumn is a steampipe column read from the resource at a field path,
+// e.g. Description.Sha.
+type csvColumn struct {
+	Name string
+	Path []string
+}
+
+// csvWriter flattens resources into the columns of their steampipe table.
+type csvWriter struct {
+	w          *csv.Writer
+	columns    []csvColumn
+	wroteTitle bool
+}
+
+// csvColumns returns the columns of the steampipe table of resourceType that
+// are read with transform.FromField.
+func csvColumns(resourceType string) ([]csvColumn, error) {
+	plg := global.Plugin()
+	tableName := global.ExtractTableName(resourceType)
+	if plg == nil || tableName == "" {
+		return nil, fmt.Errorf("no steampipe table for %s, csv output needs its columns", resourceType)
+	}
+	table, ok := plg.TableMap[tableName]
+	if !ok {
+		return nil, fmt.Errorf("steampipe table %s of %s not found", tableName, resourceType)
+	}
+
+	var columns []csvColumn
+	for _, column := range table.Columns {
+		if path := fieldPath(column); path != "" {
+			columns = append(columns, csvColumn{Name: column.Name, Path: strings.Split(path, ".")})
+		}
+	}
+	return columns, nil
+}
+
+// fieldPath returns the first field path of a FromField column transform.
+func fieldPath(column *plugin.Column) string {
+	if column.Transform == nil || len(column.Transform.Transforms) == 0 {
+		return ""
+	}
+	switch p := column.Transform.Transforms[0].Param.(type) {
+	case []string:
+		if len(p) > 0 {
+			return p[0]
+		}
+	case string:
+		return p
+	}
+	return ""
+}
+
+func (c *csvWriter) writeTitle() error {
+	if c.wroteTitle {
+		return nil
+	}
+	title := make([]string, 0, len(c.columns))
+	for _, column := range c.columns {
+		title = append(title, column.Name)
+	}
+	if err := c.w.Write(title); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	c.wroteTitle = true
+	return nil
+}
+
+func (c *csvWriter) Write(resource es.Resource) error {
+	if err := c.writeTitle(); err != nil {
+		return err
+	}
+
+	// The field paths use Go field names, so they are resolved on the JSON
+	// form of the resource ignoring case and underscores.
+	resJSON, err := json.Marshal(resource)
+	if err != nil {
+		return fmt.Errorf("failed to marshal resource JSON: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(resJSON))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("failed to decode resource JSON: %w", err)
+	}
+
+	row := make([]string, 0, len(c.columns))
+	for _, column := range c.columns {
+		cell, err := csvCell(lookupField(value, column.Path))
+		if err != nil {
+			return err
+		}
+		row = append(row, cell)
+	}
+	if err := c.w.Write(row); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	return nil
+}
+
+func (c *csvWriter) Close() error {
+	if err := c.writeTitle(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func lookupField(value any, path []string) any {
+	for _, segment := range path {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = nil
+		for key, child := range m {
+			if fieldKey(key) == fieldKey(segment) {
+				value = child
+				break
+			}
+		}
+	}
+	return value
+}
+
+func fieldKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// csvCell formats scalars as they are and everything else as JSON.
+func csvCell(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return fmt.Sprint(v), nil
+	default:
+		cell, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal csv cell: %w", err)
+		}
+		return string(cell), nil
+	}
+}
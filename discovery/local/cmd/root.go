@@ -30,6 +30,11 @@ func Execute() {
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "YAML or JSON file with the credentials and labels of the integration")
+	rootCmd.PersistentFlags().StringArrayVar(&credFlags, "cred", nil, "Credential as key=value, can be repeated")
+	rootCmd.PersistentFlags().StringArrayVar(&labelFlags, "label", nil, "Integration label as key=value, can be repeated")
+
 	rootCmd.AddCommand(describerCmd)
 	rootCmd.AddCommand(getDescriberCmd)
+	rootCmd.AddCommand(replayCmd)
 }
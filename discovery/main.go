@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/opengovern/og-describer-template/discovery/pkg"
 	"github.com/opengovern/og-describer-template/discovery/pkg/worker"
 	"os"
 	"os/signal"
@@ -28,7 +29,9 @@ func main() {
 		}
 	}()
 
-	if err := worker.WorkerCommand().ExecuteContext(ctx); err != nil {
+	cmd := worker.WorkerCommand()
+	cmd.AddCommand(pkg.DescribeWorkerCommand())
+	if err := cmd.ExecuteContext(ctx); err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,35 @@
+package pkg
+
+import (
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// DescribeWorkerCommand consumes the scheduled (or, with MANUAL_TRIGGERS=true,
+// the manual) describe jobs and runs each of them through the DescribeHandler.
+func DescribeWorkerCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "describe-worker",
+		Short: "Run scheduled describe jobs from the describe job queue",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			cmd.SilenceUsage = true
+			logger, err := zap.NewProduction()
+			if err != nil {
+				return err
+			}
+
+			w, err := NewWorker(
+				logger,
+				cmd.Context(),
+			)
+			if err != nil {
+				return err
+			}
+
+			return w.Run(ctx)
+		},
+	}
+
+	return cmd
+}
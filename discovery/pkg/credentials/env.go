@@ -0,0 +1,54 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvCredentialPrefixEnv overrides DefaultEnvCredentialPrefix.
+const EnvCredentialPrefixEnv = "DESCRIBER_CREDENTIAL_PREFIX"
+
+const DefaultEnvCredentialPrefix = "DESCRIBER_CREDENTIAL_"
+
+// configEnvs are the variables configuring this package. They share
+// DefaultEnvCredentialPrefix and must not be read as credentials.
+var configEnvs = map[string]bool{
+	EnvCredentialPrefixEnv: true,
+	CredentialSourceEnv:    true,
+	CredentialFileEnv:      true,
+}
+
+// EnvCredentialSource reads credentials from environment variables, for local
+// runs and tests. DESCRIBER_CREDENTIAL_PAT_TOKEN becomes the "pat_token" key.
+// The integration secret is ignored, every integration gets the same credentials.
+type EnvCredentialSource struct {
+	prefix string
+}
+
+func NewEnvCredentialSource(prefix string) *EnvCredentialSource {
+	if prefix == "" {
+		prefix = DefaultEnvCredentialPrefix
+	}
+	return &EnvCredentialSource{prefix: prefix}
+}
+
+func (s *EnvCredentialSource) Decrypt(_ context.Context, _ string) (map[string]any, error) {
+	config := make(map[string]any)
+	for _, kv := range os.Environ() {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(key, s.prefix) || configEnvs[key] {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(key, s.prefix))
+		if name == "" {
+			continue
+		}
+		config[name] = value
+	}
+	if len(config) == 0 {
+		return nil, fmt.Errorf("no credentials found in environment variables with prefix %s", s.prefix)
+	}
+	return config, nil
+}
@@ -0,0 +1,58 @@
+package credentials
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestEnvCredentialSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		env     map[string]string
+		want    map[string]any
+		wantErr bool
+	}{
+		{
+			name: "default prefix",
+			env:  map[string]string{"DESCRIBER_CREDENTIAL_PAT_TOKEN": "token", "OTHER_PAT_TOKEN": "other"},
+			want: map[string]any{"pat_token": "token"},
+		},
+		{
+			name: "skips the config envs",
+			env: map[string]string{
+				"DESCRIBER_CREDENTIAL_PAT_TOKEN": "token",
+				CredentialSourceEnv:              "env",
+				CredentialFileEnv:                "/tmp/credentials.json",
+				EnvCredentialPrefixEnv:           "DESCRIBER_CREDENTIAL_",
+			},
+			want: map[string]any{"pat_token": "token"},
+		},
+		{
+			name:   "custom prefix",
+			prefix: "GITHUB_",
+			env:    map[string]string{"GITHUB_APP_ID": "1", "DESCRIBER_CREDENTIAL_PAT_TOKEN": "token"},
+			want:   map[string]any{"app_id": "1"},
+		},
+		{
+			name:    "nothing set",
+			prefix:  "NOT_SET_ANYWHERE_",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			got, err := NewEnvCredentialSource(tt.prefix).Decrypt(context.Background(), "ignored")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decrypt() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decrypt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
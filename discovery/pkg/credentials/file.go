@@ -0,0 +1,120 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// CredentialFileEnv holds the path of the credentials file used by FileCredentialSource.
+const CredentialFileEnv = "DESCRIBER_CREDENTIAL_FILE"
+
+// CredentialFileIntegrationsKey is the top level key of a credentials file
+// holding the credentials of several integrations, keyed by integration secret.
+const CredentialFileIntegrationsKey = "integrations"
+
+// fileReadTimeout bounds reading and decrypting the credentials file. The read
+// is shared by every caller, so it does not use the context of any of them.
+const fileReadTimeout = time.Minute
+
+// FileCredentialSource reads credentials from a local file encrypted with sops,
+// usually with an age key (SOPS_AGE_KEY_FILE). Plain JSON files are accepted as
+// well to make local testing easy.
+//
+// The file holds either the credentials object itself, or under the
+// CredentialFileIntegrationsKey key an object keyed by integration secret whose
+// values are the credentials of that integration.
+type FileCredentialSource struct {
+	path string
+
+	mu      sync.Mutex
+	content map[string]any
+}
+
+func NewFileCredentialSource(path string) (*FileCredentialSource, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%s is not set", CredentialFileEnv)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("credential file: %w", err)
+	}
+	return &FileCredentialSource{path: path}, nil
+}
+
+func (s *FileCredentialSource) Decrypt(_ context.Context, cipherText string) (map[string]any, error) {
+	content, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return credentialsFromContent(content, cipherText)
+}
+
+// credentialsFromContent returns the credentials of the integration secret
+// from the content of a credentials file.
+func credentialsFromContent(content map[string]any, cipherText string) (map[string]any, error) {
+	raw, keyed := content[CredentialFileIntegrationsKey]
+	if !keyed {
+		return content, nil
+	}
+	integrations, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s in credential file is not an object", CredentialFileIntegrationsKey)
+	}
+	if v, ok := integrations[cipherText].(map[string]any); ok && cipherText != "" {
+		return v, nil
+	}
+	return nil, fmt.Errorf("no credentials for the integration secret in credential file")
+}
+
+// load reads the file on the first successful call. Failures are not cached,
+// the next call tries again.
+func (s *FileCredentialSource) load() (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.content != nil {
+		return s.content, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fileReadTimeout)
+	defer cancel()
+	content, err := s.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.content = content
+	return content, nil
+}
+
+func (s *FileCredentialSource) read(ctx context.Context) (map[string]any, error) {
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credential file: %w", err)
+	}
+
+	content := make(map[string]any)
+	if err := json.Unmarshal(raw, &content); err == nil {
+		if _, encrypted := content["sops"]; !encrypted {
+			return content, nil
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sops", "--decrypt", "--output-type", "json", s.path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to decrypt credential file with sops: %w: %s", err, stderr.String())
+	}
+
+	content = make(map[string]any)
+	if err := json.Unmarshal(stdout.Bytes(), &content); err != nil {
+		return nil, fmt.Errorf("failed to parse decrypted credential file: %w", err)
+	}
+	return content, nil
+}
@@ -0,0 +1,88 @@
+package credentials
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCredentialsFromContent(t *testing.T) {
+	single := map[string]any{"pat_token": "token", "app": map[string]any{"id": "1"}}
+	keyed := map[string]any{
+		CredentialFileIntegrationsKey: map[string]any{
+			"secret-a": map[string]any{"pat_token": "a"},
+			"secret-b": map[string]any{"pat_token": "b"},
+		},
+	}
+	tests := []struct {
+		name       string
+		content    map[string]any
+		cipherText string
+		want       map[string]any
+		wantErr    bool
+	}{
+		{name: "single credentials", content: single, cipherText: "anything", want: single},
+		{name: "single credentials with only object values", content: map[string]any{"app": map[string]any{"id": "1"}}, cipherText: "app",
+			want: map[string]any{"app": map[string]any{"id": "1"}}},
+		{name: "keyed", content: keyed, cipherText: "secret-b", want: map[string]any{"pat_token": "b"}},
+		{name: "keyed unknown secret", content: keyed, cipherText: "secret-c", wantErr: true},
+		{name: "keyed empty secret", content: keyed, cipherText: "", wantErr: true},
+		{name: "keyed not an object", content: map[string]any{CredentialFileIntegrationsKey: "secret-a"}, cipherText: "secret-a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := credentialsFromContent(tt.content, tt.cipherText)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("credentialsFromContent() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("credentialsFromContent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileCredentialSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string
+		cipherText string
+		want       map[string]any
+		wantErr    bool
+	}{
+		{name: "plain json", file: `{"pat_token": "token"}`, want: map[string]any{"pat_token": "token"}},
+		{name: "plain json keyed", file: `{"integrations": {"secret": {"pat_token": "token"}}}`, cipherText: "secret",
+			want: map[string]any{"pat_token": "token"}},
+		{name: "keyed unknown secret", file: `{"integrations": {"secret": {"pat_token": "token"}}}`, cipherText: "other", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "credentials.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			src, err := NewFileCredentialSource(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := src.Decrypt(context.Background(), tt.cipherText)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decrypt() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decrypt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFileCredentialSourceMissingFile(t *testing.T) {
+	if _, err := NewFileCredentialSource(""); err == nil {
+		t.Error("NewFileCredentialSource(\"\") succeeded, want an error")
+	}
+	if _, err := NewFileCredentialSource(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("NewFileCredentialSource() of a missing file succeeded, want an error")
+	}
+}
@@ -0,0 +1,54 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/opengovern/og-util/pkg/vault"
+	"go.uber.org/zap"
+)
+
+// CredentialSourceEnv overrides the credential source picked from the vault
+// config, one of SourceVault, SourceEnv or SourceFile.
+const CredentialSourceEnv = "DESCRIBER_CREDENTIAL_SOURCE"
+
+const (
+	SourceVault = "vault"
+	SourceEnv   = "env"
+	SourceFile  = "file"
+)
+
+// CredentialSource turns the secret stored on an integration into the
+// credentials map handed to provider.AccountCredentialsFromMap.
+type CredentialSource interface {
+	Decrypt(ctx context.Context, cipherText string) (map[string]any, error)
+}
+
+// NewCredentialSource picks the credential source from the CredentialSourceEnv
+// environment variable, falling back to the provider of the vault config.
+func NewCredentialSource(ctx context.Context, logger *zap.Logger, cfg vault.Config) (CredentialSource, error) {
+	source := strings.ToLower(strings.TrimSpace(os.Getenv(CredentialSourceEnv)))
+	if source == "" {
+		switch strings.ToLower(string(cfg.Provider)) {
+		case SourceEnv, SourceFile:
+			source = strings.ToLower(string(cfg.Provider))
+		default:
+			source = SourceVault
+		}
+	}
+
+	logger.Info("Setting up credential source", zap.String("source", source))
+
+	switch source {
+	case SourceVault:
+		return NewVaultCredentialSource(ctx, logger, cfg)
+	case SourceEnv:
+		return NewEnvCredentialSource(os.Getenv(EnvCredentialPrefixEnv)), nil
+	case SourceFile:
+		return NewFileCredentialSource(os.Getenv(CredentialFileEnv))
+	default:
+		return nil, fmt.Errorf("unknown credential source: %s", source)
+	}
+}
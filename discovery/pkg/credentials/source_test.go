@@ -0,0 +1,53 @@
+package credentials
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opengovern/og-util/pkg/vault"
+	"go.uber.org/zap"
+)
+
+func TestNewCredentialSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	if err := os.WriteFile(path, []byte(`{"pat_token": "token"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(CredentialFileEnv, path)
+
+	tests := []struct {
+		name     string
+		source   string
+		provider vault.Provider
+		want     CredentialSource
+		wantErr  bool
+	}{
+		{name: "env from the env", source: "env", want: &EnvCredentialSource{}},
+		{name: "file from the env", source: " File ", want: &FileCredentialSource{}},
+		{name: "env overrides the provider", source: "env", provider: "file", want: &EnvCredentialSource{}},
+		{name: "env from the provider", provider: "env", want: &EnvCredentialSource{}},
+		{name: "file from the provider", provider: "file", want: &FileCredentialSource{}},
+		{name: "unknown source", source: "kms", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(CredentialSourceEnv, tt.source)
+			got, err := NewCredentialSource(context.Background(), zap.NewNop(), vault.Config{Provider: tt.provider})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewCredentialSource() error = %v, want error %v", err, tt.wantErr)
+			}
+			switch tt.want.(type) {
+			case *EnvCredentialSource:
+				if _, ok := got.(*EnvCredentialSource); !ok {
+					t.Errorf("NewCredentialSource() = %T, want *EnvCredentialSource", got)
+				}
+			case *FileCredentialSource:
+				if _, ok := got.(*FileCredentialSource); !ok {
+					t.Errorf("NewCredentialSource() = %T, want *FileCredentialSource", got)
+				}
+			}
+		})
+	}
+}
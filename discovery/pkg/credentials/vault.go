@@ -0,0 +1,30 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opengovern/og-util/pkg/vault"
+	"go.uber.org/zap"
+)
+
+// VaultCredentialSource decrypts integration secrets with the HashiCorp vault
+// of the vault config, as the describers always did.
+type VaultCredentialSource struct {
+	vault vault.VaultSourceConfig
+}
+
+func NewVaultCredentialSource(ctx context.Context, logger *zap.Logger, cfg vault.Config) (*VaultCredentialSource, error) {
+	vaultSc, err := vault.NewHashiCorpVaultClient(ctx, logger, cfg.HashiCorp, cfg.KeyId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize HashiCorp vault: %w", err)
+	}
+
+	logger.Info("Vault setup complete")
+
+	return &VaultCredentialSource{vault: vaultSc}, nil
+}
+
+func (s *VaultCredentialSource) Decrypt(ctx context.Context, cipherText string) (map[string]any, error) {
+	return s.vault.Decrypt(ctx, cipherText)
+}
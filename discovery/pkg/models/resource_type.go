@@ -20,6 +20,17 @@ type ResourceType struct {
 	Annotations map[string]string
 	Labels      map[string]string
 	Tags        map[string][]string
+
+	// Redactions mask secrets in the descriptions before they are sent.
+	Redactions []RedactionRule
+}
+
+// RedactionRule is a redaction rule of resource-types.json, applied as a
+// normalize.RedactionRule.
+type RedactionRule struct {
+	Field   string
+	Pattern string
+	Action  string
 }
 
 func (r ResourceType) GetIntegrationType() integration.Type {
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DescribeStats collects counters while a single resource type is described.
+// Describers reach it through describers.GetStatsFromContext. It is safe for
+// concurrent use and a nil *DescribeStats ignores every update.
+type DescribeStats struct {
+	pages        atomic.Int64
+	apiCalls     atomic.Int64
+	retries      atomic.Int64
+	throttleWait atomic.Int64
+	bytesSent    atomic.Int64
+	sendBlocked  atomic.Int64
+	deleted      atomic.Int64
+	// deletionsSkipped counts tombstones withheld by the deletion guard.
+	deletionsSkipped atomic.Int64
+}
+
+// DescribeStatsSnapshot is a point in time copy of DescribeStats.
+type DescribeStatsSnapshot struct {
+	Pages        int64
+	APICalls     int64
+	Retries      int64
+	ThrottleWait time.Duration
+	BytesSent    int64
+	SendBlocked  time.Duration
+	Deleted      int64
+	// DeletionsSkipped is the number of resources the deletion guard kept.
+	DeletionsSkipped int64
+}
+
+func NewDescribeStats() *DescribeStats {
+	return &DescribeStats{}
+}
+
+// AddPage records a page fetched from the provider API.
+func (s *DescribeStats) AddPage() {
+	if s != nil {
+		s.pages.Add(1)
+	}
+}
+
+// AddAPICall records a request made to the provider API.
+func (s *DescribeStats) AddAPICall() {
+	if s != nil {
+		s.apiCalls.Add(1)
+	}
+}
+
+// AddRetry records a retried request or describe attempt.
+func (s *DescribeStats) AddRetry() {
+	if s != nil {
+		s.retries.Add(1)
+	}
+}
+
+// AddThrottleWait records time spent waiting on provider rate limits.
+func (s *DescribeStats) AddThrottleWait(d time.Duration) {
+	if s != nil && d > 0 {
+		s.throttleWait.Add(int64(d))
+	}
+}
+
+// AddBytesSent records the size of documents delivered to the sink.
+func (s *DescribeStats) AddBytesSent(n int) {
+	if s != nil && n > 0 {
+		s.bytesSent.Add(int64(n))
+	}
+}
+
+// AddSendBlocked records time the describer waited on a full sink queue.
+func (s *DescribeStats) AddSendBlocked(d time.Duration) {
+	if s != nil && d > 0 {
+		s.sendBlocked.Add(int64(d))
+	}
+}
+
+// AddDeleted records resources tombstoned because the provider no longer
+// returns them.
+func (s *DescribeStats) AddDeleted(n int) {
+	if s != nil && n > 0 {
+		s.deleted.Add(int64(n))
+	}
+}
+
+// AddDeletionsSkipped records resources not tombstoned because the deletion
+// guard tripped.
+func (s *DescribeStats) AddDeletionsSkipped(n int) {
+	if s != nil && n > 0 {
+		s.deletionsSkipped.Add(int64(n))
+	}
+}
+
+func (s *DescribeStats) Snapshot() DescribeStatsSnapshot {
+	if s == nil {
+		return DescribeStatsSnapshot{}
+	}
+	return DescribeStatsSnapshot{
+		Pages:        s.pages.Load(),
+		APICalls:     s.apiCalls.Load(),
+		Retries:      s.retries.Load(),
+		ThrottleWait: time.Duration(s.throttleWait.Load()),
+		BytesSent:    s.bytesSent.Load(),
+		SendBlocked:  time.Duration(s.sendBlocked.Load()),
+		Deleted:      s.deleted.Load(),
+
+		DeletionsSkipped: s.deletionsSkipped.Load(),
+	}
+}
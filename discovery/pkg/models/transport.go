@@ -0,0 +1,106 @@
+package models
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// MaxThrottleWait is the longest Retry-After StatsTransport waits out,
+	// longer ones are returned to the describer.
+	MaxThrottleWait = time.Minute
+	// maxThrottleRetries bounds the requests retried after a 429 answer.
+	maxThrottleRetries = 3
+)
+
+type statsContextKey struct{}
+
+// ContextWithStats attaches the stats collector of the current describe.
+func ContextWithStats(ctx context.Context, stats *DescribeStats) context.Context {
+	return context.WithValue(ctx, statsContextKey{}, stats)
+}
+
+// StatsFromContext returns the stats collector of the current describe, or
+// nil when there is none.
+func StatsFromContext(ctx context.Context) *DescribeStats {
+	stats, _ := ctx.Value(statsContextKey{}).(*DescribeStats)
+	return stats
+}
+
+// StatsTransport counts every request sent through it as an API call on the
+// stats collector of the request context. A 429 answer carrying a Retry-After
+// of at most MaxThrottleWait is waited out, recorded as throttle wait and
+// retried, as long as the request body can be sent again.
+type StatsTransport struct {
+	// Base sends the requests, http.DefaultTransport when nil.
+	Base http.RoundTripper
+}
+
+// NewStatsHTTPClient returns an http.Client sending through StatsTransport.
+func NewStatsHTTPClient() *http.Client {
+	return &http.Client{Transport: &StatsTransport{}}
+}
+
+func (t *StatsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	ctx := req.Context()
+	stats := StatsFromContext(ctx)
+
+	for attempt := 0; ; attempt++ {
+		stats.AddAPICall()
+		resp, err := base.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt >= maxThrottleRetries {
+			return resp, err
+		}
+		wait, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok || wait > MaxThrottleWait || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		stats.AddThrottleWait(wait)
+		stats.AddRetry()
+	}
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as an HTTP date.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := at.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	opengovernance "github.com/opengovern/og-describer-github/discovery/pkg/es"
 	"github.com/opengovern/og-describer-template/discovery/pkg/orchestrator"
 	"github.com/opengovern/og-describer-template/global"
 	"os"
@@ -14,18 +13,13 @@ import (
 	"github.com/nats-io/nats.go/jetstream"
 
 	"github.com/opengovern/og-util/pkg/describe"
-	esSinkClient "github.com/opengovern/og-util/pkg/es/ingest/client"
 	"github.com/opengovern/og-util/pkg/jq"
-	"github.com/opengovern/og-util/pkg/opengovernance-es-sdk"
 	"go.uber.org/zap"
 )
 
 type Worker struct {
-	logger   *zap.Logger
-	esClient opengovernance.Client
-	jq       *jq.JobQueue
-
-	esSinkClient esSinkClient.EsSinkServiceClient
+	logger *zap.Logger
+	jq     *jq.JobQueue
 }
 
 var (
@@ -81,8 +75,6 @@ func (w *Worker) Run(ctx context.Context) error {
 	}, func(msg jetstream.Msg) {
 		w.logger.Info("received a new job")
 
-		defer msg.Ack()
-
 		ctx, cancel := context.WithTimeoutCause(ctx, time.Minute*25, errors.New("describe worker timed out"))
 		defer cancel()
 
@@ -0,0 +1,138 @@
+// Package normalize turns resource descriptions into the generic JSON values
+// that are indexed, applying a pipeline of steps on the way.
+package normalize
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Step rewrites a single value of a description. Steps are called for every
+// value after its children, with the dotted path of map keys leading to it;
+// slice elements share the path of their slice. Returning false drops the
+// value from its parent map, slice elements and the root are always kept.
+type Step func(path string, value any, report *Report) (any, bool)
+
+// Report tells what the steps changed in a description.
+type Report struct {
+	// Trimmed is the number of values removed from their maps, the empty maps
+	// and slices dropped by TrimEmpty.
+	Trimmed int
+	// Timestamps is the number of timestamps rewritten to RFC 3339 UTC.
+	Timestamps int
+	// Redacted and Truncated hold the paths of the values redacted and
+	// truncated, without duplicates.
+	Redacted  []string
+	Truncated []string
+}
+
+func (r *Report) addPath(paths *[]string, path string) {
+	for _, p := range *paths {
+		if p == path {
+			return
+		}
+	}
+	*paths = append(*paths, path)
+}
+
+// Result is a normalised description.
+type Result struct {
+	// Description is the normalised value, objects decoded as map[string]any
+	// and numbers as json.Number.
+	Description any
+	// Source is the JSON the description was decoded from. The steps being
+	// deterministic, it identifies the normalised description too.
+	Source []byte
+	Report Report
+}
+
+// Pipeline applies its steps in order to every value of a description.
+type Pipeline struct {
+	steps []Step
+}
+
+func New(steps ...Step) *Pipeline {
+	return &Pipeline{steps: steps}
+}
+
+// Default trims empty maps and slices, truncates strings longer than
+// DefaultMaxStringBytes and canonicalises timestamps.
+func Default() *Pipeline {
+	return New(TrimEmpty(), Truncate(DefaultMaxStringBytes), CanonicalTimestamps())
+}
+
+// With returns a pipeline running the steps of p followed by steps.
+func (p *Pipeline) With(steps ...Step) *Pipeline {
+	return New(append(append([]Step(nil), p.steps...), steps...)...)
+}
+
+// Normalize marshals description once, decodes it into generic values keeping
+// numbers exact and runs the steps over the result.
+func (p *Pipeline) Normalize(description any) (Result, error) {
+	source, err := json.Marshal(description)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to marshal description: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(source))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return Result{}, fmt.Errorf("failed to decode description: %w", err)
+	}
+
+	result := Result{Source: source}
+	result.Description, _ = p.walk("", value, &result.Report)
+	sort.Strings(result.Report.Redacted)
+	sort.Strings(result.Report.Truncated)
+	return result, nil
+}
+
+func (p *Pipeline) walk(path string, value any, report *Report) (any, bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if newChild, keep := p.walk(childPath, child, report); keep {
+				v[key] = newChild
+			} else {
+				delete(v, key)
+				report.Trimmed++
+			}
+		}
+	case []any:
+		for i, child := range v {
+			v[i], _ = p.walk(path, child, report)
+		}
+	}
+
+	keep := true
+	for _, step := range p.steps {
+		if value, keep = step(path, value, report); !keep {
+			break
+		}
+	}
+	return value, keep || path == ""
+}
+
+// matchPath reports whether path matches pattern, both dotted, where a "*"
+// segment of the pattern matches any single segment. Matching ignores case.
+func matchPath(pattern, path string) bool {
+	patternSegments := strings.Split(pattern, ".")
+	pathSegments := strings.Split(path, ".")
+	if len(patternSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range patternSegments {
+		if segment != "*" && !strings.EqualFold(segment, pathSegments[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package normalize
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeKeepsNumbersExact(t *testing.T) {
+	description := map[string]any{"ID": uint64(9007199254740993), "Ratio": 0.1}
+	result, err := New().Normalize(description)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := result.Description.(map[string]any)
+	if got["ID"] != json.Number("9007199254740993") {
+		t.Errorf("ID = %#v, want json.Number 9007199254740993", got["ID"])
+	}
+	if got["Ratio"] != json.Number("0.1") {
+		t.Errorf("Ratio = %#v, want json.Number 0.1", got["Ratio"])
+	}
+	if string(result.Source) != `{"ID":9007199254740993,"Ratio":0.1}` {
+		t.Errorf("Source = %s", result.Source)
+	}
+}
+
+func TestNormalizeStepOrderAndPaths(t *testing.T) {
+	var paths []string
+	record := func(path string, value any, report *Report) (any, bool) {
+		paths = append(paths, path)
+		return value, true
+	}
+	description := map[string]any{
+		"A": map[string]any{"B": "x"},
+		"L": []any{"y"},
+	}
+	if _, err := New(record).Normalize(description); err != nil {
+		t.Fatal(err)
+	}
+
+	// Children come before their parent, slice elements share its path.
+	index := make(map[string][]int)
+	for i, p := range paths {
+		index[p] = append(index[p], i)
+	}
+	if len(paths) != 5 {
+		t.Fatalf("steps called with %v, want 5 values", paths)
+	}
+	if index["A.B"][0] > index["A"][0] || index["A"][0] > index[""][0] {
+		t.Errorf("steps not called children first: %v", paths)
+	}
+	if len(index["L"]) != 2 {
+		t.Errorf("slice element path: %v", paths)
+	}
+}
+
+func TestNormalizeKeepsRoot(t *testing.T) {
+	dropAll := func(path string, value any, report *Report) (any, bool) {
+		return value, false
+	}
+	result, err := New(dropAll).Normalize(map[string]any{"A": "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Description, map[string]any{}) {
+		t.Errorf("Description = %#v, want empty root map", result.Description)
+	}
+}
+
+func TestWithDoesNotShareSteps(t *testing.T) {
+	base := New(TrimEmpty())
+	_ = base.With(Truncate(1))
+	if len(base.steps) != 1 {
+		t.Errorf("With changed the steps of its receiver")
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "Secret", path: "Secret", want: true},
+		{pattern: "secret", path: "Secret", want: true},
+		{pattern: "Config.Token", path: "Config.Token", want: true},
+		{pattern: "Config.*", path: "Config.Token", want: true},
+		{pattern: "*.Token", path: "Env.Token", want: true},
+		{pattern: "*", path: "Config.Token", want: false},
+		{pattern: "Config", path: "Config.Token", want: false},
+		{pattern: "Config.Token", path: "Config", want: false},
+		{pattern: "Config.Token", path: "Config.Tokens", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchPath(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package normalize
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	RedactedValue = "REDACTED"
+
+	RedactMask = "mask"
+	RedactHash = "hash"
+
+	// secretGroup is the name of the pattern group redacted instead of the
+	// whole match, so "ENV TOKEN=abc" can keep its key.
+	secretGroup = "secret"
+)
+
+// RedactionRule selects the description values to redact.
+type RedactionRule struct {
+	// Field is a dotted description path where a "*" segment matches any key.
+	// Without it the rule applies to every string.
+	Field string
+	// Pattern, when set, only redacts its matches in string values, or the
+	// group named "secret" of them.
+	Pattern string
+	// Action is RedactMask, the default, or RedactHash which keeps values
+	// comparable without revealing them.
+	Action string
+}
+
+type redaction struct {
+	field   string
+	pattern *regexp.Regexp
+	secret  int
+	hash    bool
+}
+
+// Redaction compiles rules into a step replacing the values they select with
+// RedactedValue or with their sha256 hash.
+func Redaction(rules []RedactionRule) (Step, error) {
+	redactions := make([]redaction, 0, len(rules))
+	for _, rule := range rules {
+		r := redaction{field: strings.TrimSpace(rule.Field), secret: -1}
+		switch strings.ToLower(strings.TrimSpace(rule.Action)) {
+		case "", RedactMask:
+		case RedactHash:
+			r.hash = true
+		default:
+			return nil, fmt.Errorf("unknown redaction action %s", rule.Action)
+		}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redaction pattern %s: %w", rule.Pattern, err)
+			}
+			r.pattern = pattern
+			r.secret = pattern.SubexpIndex(secretGroup)
+		}
+		if r.field == "" && r.pattern == nil {
+			return nil, fmt.Errorf("redaction rule needs a field or a pattern")
+		}
+		redactions = append(redactions, r)
+	}
+
+	return func(path string, value any, report *Report) (any, bool) {
+		if value == nil || path == "" {
+			return value, true
+		}
+		for _, r := range redactions {
+			if r.field != "" && !matchPath(r.field, path) {
+				continue
+			}
+			if redacted, ok := r.apply(value); ok {
+				report.addPath(&report.Redacted, path)
+				value = redacted
+			}
+		}
+		return value, true
+	}, nil
+}
+
+func (r redaction) apply(value any) (any, bool) {
+	if r.pattern == nil {
+		return r.replacement(value), true
+	}
+	s, ok := value.(string)
+	if !ok {
+		return value, false
+	}
+	matches := r.pattern.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return value, false
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if r.secret >= 0 {
+			start, end = m[2*r.secret], m[2*r.secret+1]
+		}
+		if start < last || start == end {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(r.replacement(s[start:end]).(string))
+		last = end
+	}
+	if last == 0 {
+		return value, false
+	}
+	b.WriteString(s[last:])
+	return b.String(), true
+}
+
+func (r redaction) replacement(value any) any {
+	if !r.hash {
+		return RedactedValue
+	}
+	s, ok := value.(string)
+	if !ok {
+		content, _ := json.Marshal(value)
+		s = string(content)
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
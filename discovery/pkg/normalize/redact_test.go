@@ -0,0 +1,167 @@
+package normalize
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestRedaction(t *testing.T) {
+	sum := sha256.Sum256([]byte("hunter2"))
+	hashed := "sha256:" + hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name        string
+		rules       []RedactionRule
+		description map[string]any
+		want        map[string]any
+		redacted    []string
+	}{
+		{
+			name:        "masks a field",
+			rules:       []RedactionRule{{Field: "Password"}},
+			description: map[string]any{"Password": "hunter2", "Name": "db"},
+			want:        map[string]any{"Password": RedactedValue, "Name": "db"},
+			redacted:    []string{"Password"},
+		},
+		{
+			name:        "hashes a field",
+			rules:       []RedactionRule{{Field: "password", Action: RedactHash}},
+			description: map[string]any{"Password": "hunter2"},
+			want:        map[string]any{"Password": hashed},
+			redacted:    []string{"Password"},
+		},
+		{
+			name:        "masks whole objects",
+			rules:       []RedactionRule{{Field: "Config"}},
+			description: map[string]any{"Config": map[string]any{"Token": "abc"}},
+			want:        map[string]any{"Config": RedactedValue},
+			redacted:    []string{"Config"},
+		},
+		{
+			name:        "wildcard segment",
+			rules:       []RedactionRule{{Field: "*.Token"}},
+			description: map[string]any{"A": map[string]any{"Token": "a"}, "B": map[string]any{"Token": "b", "Name": "n"}},
+			want:        map[string]any{"A": map[string]any{"Token": RedactedValue}, "B": map[string]any{"Token": RedactedValue, "Name": "n"}},
+			redacted:    []string{"A.Token", "B.Token"},
+		},
+		{
+			name:        "pattern without field applies to every string",
+			rules:       []RedactionRule{{Pattern: `ghp_\w+`}},
+			description: map[string]any{"A": "token ghp_abc here", "B": map[string]any{"C": "ghp_def"}, "D": "clean"},
+			want:        map[string]any{"A": "token " + RedactedValue + " here", "B": map[string]any{"C": RedactedValue}, "D": "clean"},
+			redacted:    []string{"A", "B.C"},
+		},
+		{
+			name:        "secret group keeps the rest of the match",
+			rules:       []RedactionRule{{Field: "Env", Pattern: `TOKEN=(?P<secret>\S+)`}},
+			description: map[string]any{"Env": "TOKEN=abc TOKEN=def"},
+			want:        map[string]any{"Env": "TOKEN=" + RedactedValue + " TOKEN=" + RedactedValue},
+			redacted:    []string{"Env"},
+		},
+		{
+			name:        "no match is not reported",
+			rules:       []RedactionRule{{Field: "Env", Pattern: `TOKEN=(?P<secret>\S+)`}},
+			description: map[string]any{"Env": "PATH=/bin"},
+			want:        map[string]any{"Env": "PATH=/bin"},
+		},
+		{
+			name:        "slice elements share the path of the slice",
+			rules:       []RedactionRule{{Field: "Keys"}},
+			description: map[string]any{"Keys": []any{"a", "b"}},
+			want:        map[string]any{"Keys": RedactedValue},
+			redacted:    []string{"Keys"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, err := Redaction(tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := New(step).Normalize(tt.description)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Description, tt.want) {
+				t.Errorf("Description = %#v, want %#v", result.Description, tt.want)
+			}
+			if !reflect.DeepEqual(result.Report.Redacted, tt.redacted) {
+				t.Errorf("Redacted = %v, want %v", result.Report.Redacted, tt.redacted)
+			}
+		})
+	}
+}
+
+func TestRedactionInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule RedactionRule
+	}{
+		{name: "unknown action", rule: RedactionRule{Field: "A", Action: "drop"}},
+		{name: "invalid pattern", rule: RedactionRule{Pattern: "("}},
+		{name: "no field nor pattern", rule: RedactionRule{Action: RedactHash}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Redaction([]RedactionRule{tt.rule}); err == nil {
+				t.Errorf("Redaction(%+v) succeeded, want an error", tt.rule)
+			}
+		})
+	}
+}
+
+// TestShippedDockerfileRedactions runs the redactions of the example resource
+// type of global/maps/resource-types.json.
+func TestShippedDockerfileRedactions(t *testing.T) {
+	content, err := os.ReadFile("../../../global/maps/resource-types.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resourceTypes []struct {
+		ResourceName string
+		Redactions   []RedactionRule
+	}
+	if err := json.Unmarshal(content, &resourceTypes); err != nil {
+		t.Fatal(err)
+	}
+	var rules []RedactionRule
+	for _, rt := range resourceTypes {
+		rules = append(rules, rt.Redactions...)
+	}
+	step, err := Redaction(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{name: "single pair", line: "ENV API_KEY=abc", want: "ENV API_KEY=" + RedactedValue},
+		{name: "second pair", line: "ENV A=1 SECRET_KEY=zzz", want: "ENV A=1 SECRET_KEY=" + RedactedValue},
+		{name: "double quoted value", line: `ENV API_KEY="a b" OTHER=ok`, want: "ENV API_KEY=" + RedactedValue + " OTHER=ok"},
+		{name: "single quoted value", line: "ARG DB_PASSWORD='p w'", want: "ARG DB_PASSWORD=" + RedactedValue},
+		{name: "lower case key", line: "ENV github_token=ghp_abc", want: "ENV github_token=" + RedactedValue},
+		{name: "space separated form", line: "ENV GITHUB_TOKEN ghp abc", want: "ENV GITHUB_TOKEN " + RedactedValue},
+		{name: "arg without default", line: "ARG API_KEY", want: "ARG API_KEY"},
+		{name: "other variables", line: "ENV PATH=/usr/bin LANG=C", want: "ENV PATH=/usr/bin LANG=C"},
+		{name: "instructions", line: "FROM golang:1.23", want: "FROM golang:1.23"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := New(step).Normalize(map[string]any{"DockerfileContent": "FROM x\n" + tt.line + "\nRUN make"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "FROM x\n" + tt.want + "\nRUN make"
+			if got := result.Description.(map[string]any)["DockerfileContent"]; got != want {
+				t.Errorf("DockerfileContent = %q, want %q", got, want)
+			}
+		})
+	}
+}
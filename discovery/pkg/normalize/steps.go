@@ -0,0 +1,76 @@
+package normalize
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const DefaultMaxStringBytes = 1024 * 1024
+
+// TrimEmpty drops empty maps and slices from their parent maps.
+func TrimEmpty() Step {
+	return func(path string, value any, report *Report) (any, bool) {
+		empty := false
+		switch v := value.(type) {
+		case map[string]any:
+			empty = len(v) == 0
+		case []any:
+			empty = len(v) == 0
+		}
+		if empty && path != "" {
+			return value, false
+		}
+		return value, true
+	}
+}
+
+// Truncate cuts strings longer than maxBytes, keeping them valid UTF-8.
+func Truncate(maxBytes int) Step {
+	return func(path string, value any, report *Report) (any, bool) {
+		s, ok := value.(string)
+		if !ok || maxBytes <= 0 || len(s) <= maxBytes {
+			return value, true
+		}
+		cut := maxBytes
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		report.addPath(&report.Truncated, path)
+		return s[:cut], true
+	}
+}
+
+// timestampLayouts are the formats rewritten by CanonicalTimestamps. Only
+// layouts carrying a numeric offset are listed: others cannot be converted to
+// UTC, and time.Parse reads an unknown zone abbreviation like PST as UTC. The
+// Go time.String layout is safe, its offset wins over the abbreviation.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999 -0700",
+	time.RFC1123Z,
+}
+
+// CanonicalTimestamps rewrites timestamps to RFC 3339 in UTC, so the same
+// instant is always indexed the same way.
+func CanonicalTimestamps() Step {
+	return func(path string, value any, report *Report) (any, bool) {
+		s, ok := value.(string)
+		if !ok || len(s) < len("2006-01-02T15:04:05Z") || len(s) > 64 {
+			return value, true
+		}
+		for _, layout := range timestampLayouts {
+			t, err := time.Parse(layout, strings.TrimSpace(s))
+			if err != nil {
+				continue
+			}
+			canonical := t.UTC().Format(time.RFC3339Nano)
+			if canonical != s {
+				report.Timestamps++
+			}
+			return canonical, true
+		}
+		return value, true
+	}
+}
@@ -0,0 +1,142 @@
+package normalize
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTrimEmpty(t *testing.T) {
+	tests := []struct {
+		name        string
+		description any
+		want        any
+		trimmed     int
+	}{
+		{
+			name:        "drops empty maps and slices",
+			description: map[string]any{"A": map[string]any{}, "B": []any{}, "C": "x"},
+			want:        map[string]any{"C": "x"},
+			trimmed:     2,
+		},
+		{
+			name:        "drops maps emptied by trimming",
+			description: map[string]any{"A": map[string]any{"B": map[string]any{}}},
+			want:        map[string]any{},
+			trimmed:     2,
+		},
+		{
+			name:        "keeps zero values",
+			description: map[string]any{"A": "", "B": false, "C": 0, "D": nil},
+			want:        map[string]any{"A": "", "B": false, "C": json.Number("0"), "D": nil},
+		},
+		{
+			name:        "keeps slice elements",
+			description: map[string]any{"L": []any{map[string]any{}, "x"}},
+			want:        map[string]any{"L": []any{map[string]any{}, "x"}},
+			trimmed:     0,
+		},
+		{
+			name:        "keeps an empty root",
+			description: map[string]any{},
+			want:        map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := New(TrimEmpty()).Normalize(tt.description)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Description, tt.want) {
+				t.Errorf("Description = %#v, want %#v", result.Description, tt.want)
+			}
+			if result.Report.Trimmed != tt.trimmed {
+				t.Errorf("Trimmed = %d, want %d", result.Report.Trimmed, tt.trimmed)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		maxBytes int
+		want     string
+	}{
+		{name: "short string", value: "abc", maxBytes: 3, want: "abc"},
+		{name: "long string", value: "abcdef", maxBytes: 4, want: "abcd"},
+		{name: "keeps utf8 valid", value: "aé€", maxBytes: 4, want: "aé"},
+		{name: "turned off", value: "abcdef", maxBytes: 0, want: "abcdef"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := New(Truncate(tt.maxBytes)).Normalize(map[string]any{"S": tt.value})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := result.Description.(map[string]any)["S"].(string)
+			if got != tt.want {
+				t.Errorf("S = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("S = %q is not valid UTF-8", got)
+			}
+			truncated := got != tt.value
+			if truncated != reflect.DeepEqual(result.Report.Truncated, []string{"S"}) {
+				t.Errorf("Truncated = %v", result.Report.Truncated)
+			}
+		})
+	}
+}
+
+func TestTruncateDefault(t *testing.T) {
+	long := strings.Repeat("x", DefaultMaxStringBytes+10)
+	result, err := Default().Normalize(map[string]any{"S": long})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Description.(map[string]any)["S"].(string); len(got) != DefaultMaxStringBytes {
+		t.Errorf("len(S) = %d, want %d", len(got), DefaultMaxStringBytes)
+	}
+}
+
+func TestCanonicalTimestamps(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "utc rfc3339", value: "2006-01-02T15:04:05Z", want: "2006-01-02T15:04:05Z"},
+		{name: "offset rfc3339", value: "2006-01-02T15:04:05-08:00", want: "2006-01-02T23:04:05Z"},
+		{name: "fractional seconds", value: "2006-01-02T15:04:05.120+01:00", want: "2006-01-02T14:04:05.12Z"},
+		{name: "go time string", value: "2006-01-02 15:04:05.5 -0800 PST", want: "2006-01-02T23:04:05.5Z"},
+		{name: "go time string without zone name", value: "2006-01-02 15:04:05 +0200", want: "2006-01-02T13:04:05Z"},
+		{name: "rfc1123 with offset", value: "Mon, 02 Jan 2006 15:04:05 -0800", want: "2006-01-02T23:04:05Z"},
+		{name: "zone abbreviation only", value: "Mon, 02 Jan 2006 15:04:05 PST", want: "Mon, 02 Jan 2006 15:04:05 PST"},
+		{name: "no zone", value: "2006-01-02 15:04:05", want: "2006-01-02 15:04:05"},
+		{name: "not a timestamp", value: "a string long enough to be one", want: "a string long enough to be one"},
+		{name: "date only", value: "2006-01-02", want: "2006-01-02"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := New(CanonicalTimestamps()).Normalize(map[string]any{"T": tt.value})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := result.Description.(map[string]any)["T"]; got != tt.want {
+				t.Errorf("T = %q, want %q", got, tt.want)
+			}
+			wantCount := 0
+			if tt.want != tt.value {
+				wantCount = 1
+			}
+			if result.Report.Timestamps != wantCount {
+				t.Errorf("Timestamps = %d, want %d", result.Report.Timestamps, wantCount)
+			}
+		})
+	}
+}
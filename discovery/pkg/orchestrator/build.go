@@ -0,0 +1,106 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	model "github.com/opengovern/og-describer-template/discovery/pkg/models"
+	"github.com/opengovern/og-describer-template/discovery/pkg/normalize"
+	"github.com/opengovern/og-describer-template/discovery/provider"
+	"github.com/opengovern/og-describer-template/global"
+	"github.com/opengovern/og-describer-template/global/constants"
+	describe2 "github.com/opengovern/og-util/pkg/describe"
+	"github.com/opengovern/og-util/pkg/es"
+	"github.com/turbot/steampipe-plugin-sdk/v5/plugin"
+	"go.uber.org/zap"
+)
+
+// ResourceBuilder converts the resources described for a job into the
+// resources sent to the sink. It loads the steampipe plugin and the
+// normalisation pipeline once, so a stream of resources should share one.
+type ResourceBuilder struct {
+	logger        *zap.Logger
+	job           describe2.DescribeJob
+	plugin        *plugin.Plugin
+	normalizer    *normalize.Pipeline
+	normalizerKey string
+}
+
+func NewResourceBuilder(logger *zap.Logger, job describe2.DescribeJob) (*ResourceBuilder, error) {
+	normalizer, normalizerKey, err := Normalizer(job.ResourceType)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Connect to steampipe plugin")
+	return &ResourceBuilder{
+		logger:        logger,
+		job:           job,
+		plugin:        global.Plugin(),
+		normalizer:    normalizer,
+		normalizerKey: normalizerKey,
+	}, nil
+}
+
+// Build converts resource, it returns nil for resources without a
+// description. The content hash is kept in the ContentHashKey metadata.
+func (b *ResourceBuilder) Build(resource model.Resource) (*es.Resource, error) {
+	if resource.Description == nil {
+		return nil, nil
+	}
+	job := b.job
+	normalized, err := b.normalizer.Normalize(resource.Description)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := provider.GetResourceMetadata(job, resource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get resource metadata")
+	}
+	err = provider.AdjustResource(job, &resource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to adjust resource metadata")
+	}
+
+	tags := make(map[string]string)
+
+	if b.plugin != nil {
+		tags, _, err = global.ExtractTagsAndNames(b.logger, b.plugin, job.ResourceType, resource)
+		if err != nil {
+			b.logger.Error("failed to build tags for service", zap.Error(err), zap.String("resourceType", job.ResourceType), zap.Any("resource", resource))
+		}
+	}
+
+	newTags := make([]es.Tag, 0, len(tags))
+	for k, v := range tags {
+		newTags = append(newTags, es.Tag{
+			// tags should be case-insensitive
+			Key:   strings.ToLower(k),
+			Value: strings.ToLower(v),
+		})
+	}
+
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata[ContentHashKey] = contentHash(normalized.Source, b.normalizerKey, resource.Name, newTags)
+	if len(normalized.Report.Redacted) > 0 {
+		metadata[RedactedFieldsKey] = strings.Join(normalized.Report.Redacted, ",")
+	}
+
+	return &es.Resource{
+		PlatformID:      fmt.Sprintf("%s:::%s:::%s", job.IntegrationID, job.ResourceType, resource.UniqueID()),
+		ResourceID:      resource.UniqueID(),
+		ResourceName:    resource.Name,
+		Description:     normalized.Description,
+		IntegrationType: constants.IntegrationName,
+		ResourceType:    strings.ToLower(job.ResourceType),
+		IntegrationID:   job.IntegrationID,
+		Metadata:        metadata,
+		CanonicalTags:   newTags,
+		DescribedAt:     job.DescribedAt,
+		DescribedBy:     strconv.FormatUint(uint64(job.JobID), 10),
+	}, nil
+}
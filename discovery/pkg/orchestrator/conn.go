@@ -0,0 +1,156 @@
+package orchestrator
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/credentials/oauth"
+)
+
+const (
+	GRPCCAFileEnv             = "DESCRIBER_GRPC_CA_FILE"
+	GRPCCertFileEnv           = "DESCRIBER_GRPC_CERT_FILE"
+	GRPCKeyFileEnv            = "DESCRIBER_GRPC_KEY_FILE"
+	GRPCServerNameEnv         = "DESCRIBER_GRPC_SERVER_NAME"
+	GRPCInsecureSkipVerifyEnv = "DESCRIBER_GRPC_INSECURE_SKIP_VERIFY"
+	GRPCTokenFileEnv          = "DESCRIBER_GRPC_TOKEN_FILE"
+
+	// tokenFileRefresh is how long a token read from a file is reused before
+	// the file is read again, so rotated tokens are picked up.
+	tokenFileRefresh = time.Minute
+)
+
+// ConnConfig describes how the describer connects to the platform gRPC
+// services. TLS is used whenever a token or any TLS setting is given, with
+// certificate verification unless InsecureSkipVerify is set explicitly.
+type ConnConfig struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+
+	// TokenSource authenticates each call, nil disables per call credentials.
+	TokenSource oauth2.TokenSource
+}
+
+// ConnConfigFromParams reads the grpc_tls_ca_file, grpc_tls_cert_file,
+// grpc_tls_key_file, grpc_tls_server_name, grpc_tls_insecure_skip_verify and
+// grpc_token_file params, falling back to the DESCRIBER_GRPC_* environment
+// variables. The token file, when set, takes precedence over token.
+func ConnConfigFromParams(params map[string]string, token string) ConnConfig {
+	setting := func(param, env string) string {
+		if v := strings.TrimSpace(params[param]); v != "" {
+			return v
+		}
+		return strings.TrimSpace(os.Getenv(env))
+	}
+
+	cfg := ConnConfig{
+		CAFile:     setting("grpc_tls_ca_file", GRPCCAFileEnv),
+		CertFile:   setting("grpc_tls_cert_file", GRPCCertFileEnv),
+		KeyFile:    setting("grpc_tls_key_file", GRPCKeyFileEnv),
+		ServerName: setting("grpc_tls_server_name", GRPCServerNameEnv),
+	}
+	cfg.InsecureSkipVerify, _ = strconv.ParseBool(setting("grpc_tls_insecure_skip_verify", GRPCInsecureSkipVerifyEnv))
+
+	if tokenFile := setting("grpc_token_file", GRPCTokenFileEnv); tokenFile != "" {
+		cfg.TokenSource = NewFileTokenSource(tokenFile)
+	} else if token != "" {
+		cfg.TokenSource = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	}
+	return cfg
+}
+
+func (c ConnConfig) useTLS() bool {
+	return c.TokenSource != nil || c.CAFile != "" || c.CertFile != "" || c.ServerName != "" || c.InsecureSkipVerify
+}
+
+// TLSConfig builds the client TLS configuration, nil when TLS is not used.
+func (c ConnConfig) TLSConfig() (*tls.Config, error) {
+	if !c.useTLS() {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CAFile != "" {
+		caPEM, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, fmt.Errorf("both client certificate and key are required for mTLS")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// DialOptions returns the transport and per call credentials of the config.
+func (c ConnConfig) DialOptions() ([]grpc.DialOption, error) {
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil {
+		return []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, nil
+	}
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))}
+	if c.TokenSource != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(oauth.TokenSource{
+			TokenSource: c.TokenSource,
+		}))
+	}
+	return opts, nil
+}
+
+// NewFileTokenSource returns a token source reading the access token from
+// path, for example a projected service account token. The file is read again
+// every minute so rotated tokens are picked up.
+func NewFileTokenSource(path string) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, fileTokenSource{path: path})
+}
+
+type fileTokenSource struct {
+	path string
+}
+
+func (f fileTokenSource) Token() (*oauth2.Token, error) {
+	content, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return nil, fmt.Errorf("token file %s is empty", f.path)
+	}
+	return &oauth2.Token{
+		AccessToken: token,
+		Expiry:      time.Now().Add(tokenFileRefresh),
+	}, nil
+}
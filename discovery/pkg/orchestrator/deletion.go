@@ -0,0 +1,109 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/opengovern/og-describer-template/discovery/describers"
+	describe2 "github.com/opengovern/og-util/pkg/describe"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultDeletionMaxFraction  = 0.5
+	DefaultDeletionMinResources = 10
+)
+
+// DeletionGuard withholds tombstones when a describe would delete a large
+// share of the known resources, which more often means a broken describer or
+// missing permissions than resources really being deleted.
+type DeletionGuard struct {
+	// MaxFraction is the largest share of known resources deleted at once,
+	// 1 turns the guard off.
+	MaxFraction float64
+	// MinResources is the number of known resources below which the guard
+	// does not apply.
+	MinResources int
+}
+
+// DeletionGuardFromParams reads the deletion_max_fraction and
+// deletion_min_resources params.
+func DeletionGuardFromParams(params map[string]string) DeletionGuard {
+	g := DeletionGuard{
+		MaxFraction:  DefaultDeletionMaxFraction,
+		MinResources: DefaultDeletionMinResources,
+	}
+	if f, err := strconv.ParseFloat(strings.TrimSpace(params["deletion_max_fraction"]), 64); err == nil && f >= 0 && f <= 1 {
+		g.MaxFraction = f
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(params["deletion_min_resources"])); err == nil && n >= 0 {
+		g.MinResources = n
+	}
+	return g
+}
+
+func (g DeletionGuard) check(missing, known int) error {
+	if known == 0 || known < g.MinResources || g.MaxFraction >= 1 {
+		return nil
+	}
+	if fraction := float64(missing) / float64(known); fraction > g.MaxFraction {
+		return fmt.Errorf("%d of %d resources would be deleted, more than the allowed %.0f%%",
+			missing, known, g.MaxFraction*100)
+	}
+	return nil
+}
+
+// sendDeletions sends tombstones for the known resources the describe did not
+// produce. The known resources are the indexed ones when an es client is set,
+// else the states of the previous describe. Nothing is deleted after a failed
+// describe or when the deletion guard trips.
+func sendDeletions(ctx context.Context, logger *zap.Logger, rs *ResourceSender, job describe2.DescribeJob, o describeOptions,
+	describeErr error, previous map[string]ResourceState, seen map[string]struct{}) {
+	if describeErr != nil {
+		logger.Warn("describe failed, not sending tombstones", zap.String("resourceType", job.ResourceType))
+		return
+	}
+
+	known := previous
+	if o.indexedClient != nil {
+		indexed, err := IndexedResources(ctx, o.indexedClient, job.IntegrationID, job.ResourceType)
+		if err != nil {
+			logger.Warn("failed to fetch indexed resources, not sending tombstones", zap.String("resourceType", job.ResourceType), zap.Error(err))
+			return
+		}
+		known = indexed
+	}
+
+	var missing []ResourceState
+	for platformID, state := range known {
+		if _, ok := seen[platformID]; !ok {
+			missing = append(missing, state)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	stats := describers.GetStatsFromContext(ctx)
+	if err := o.deletionGuard.check(len(missing), len(known)); err != nil {
+		logger.Warn("deletion guard tripped, not sending tombstones", zap.String("resourceType", job.ResourceType), zap.Error(err))
+		stats.AddDeletionsSkipped(len(missing))
+		return
+	}
+
+	describedBy := strconv.FormatUint(uint64(job.JobID), 10)
+	deleted := 0
+	for _, state := range missing {
+		docs, err := tombstoneDocs(state, job.IntegrationID, job.ResourceType, describedBy, job.DescribedAt)
+		if err != nil {
+			logger.Error("failed to build tombstones", zap.String("platformID", state.PlatformID), zap.Error(err))
+			continue
+		}
+		rs.SendTombstones(docs)
+		deleted++
+	}
+	stats.AddDeleted(deleted)
+	logger.Info("sent tombstones", zap.String("resourceType", job.ResourceType), zap.Int("deleted", deleted), zap.Int("known", len(known)))
+}
@@ -0,0 +1,203 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/opengovern/og-describer-template/discovery/describers"
+	"github.com/opengovern/og-describer-template/discovery/pkg/credentials"
+	model "github.com/opengovern/og-describer-template/discovery/pkg/models"
+	"github.com/opengovern/og-describer-template/discovery/pkg/retry"
+	describepkg "github.com/opengovern/og-util/pkg/describe"
+	"github.com/opengovern/og-util/proto/src/golang"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	DescribeResourceJobFailed    string = "FAILED"
+	DescribeResourceJobSucceeded string = "SUCCEEDED"
+)
+
+type TriggeredBy string
+
+const (
+	TriggeredByLocal TriggeredBy = "local"
+)
+
+func getJWTAuthToken() (string, error) {
+	privateKey, ok := os.LookupEnv("JWT_PRIVATE_KEY")
+	if !ok {
+		return "", fmt.Errorf("JWT_PRIVATE_KEY not set")
+	}
+
+	privateKeyBytes, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("JWT_PRIVATE_KEY not base64 encoded")
+	}
+
+	pk, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyBytes)
+	if err != nil {
+		return "", fmt.Errorf("JWT_PRIVATE_KEY not valid")
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"email": "describe-worker@opengovernance.io",
+	}).SignedString(pk)
+	if err != nil {
+		return "", fmt.Errorf("JWT token generation failed %v", err)
+	}
+	return token, nil
+}
+
+// DescribeHandler runs a single scheduled or manual describe job: it decrypts
+// the integration credentials, describes the resource type into the sink and
+// delivers the DescribeJobResult to the describe service.
+// TriggeredBy is not used for now but might be relevant in the future
+func DescribeHandler(ctx context.Context, logger *zap.Logger, _ TriggeredBy, input describepkg.DescribeWorkerInput) error {
+	defer logger.Sync()
+
+	var token string
+	var err error
+	if input.EndpointAuth {
+		token, err = getJWTAuthToken()
+		if err != nil {
+			return fmt.Errorf("failed to get JWT token: %w", err)
+		}
+	}
+
+	logger.Info("Setting grpc connection opts")
+	opts, err := ConnConfigFromParams(input.ExtraInputs, token).DialOptions()
+	if err != nil {
+		return fmt.Errorf("[result delivery] invalid connection config: %w", err)
+	}
+
+	logger.Info("Connecting to grpc server")
+	conn, err := grpc.NewClient(input.JobEndpoint, opts...)
+	if err != nil {
+		return fmt.Errorf("[result delivery] connection failure: %w", err)
+	}
+	defer conn.Close()
+	client := golang.NewDescribeServiceClient(conn)
+	grpcCtx := metadata.NewOutgoingContext(ctx, metadata.New(map[string]string{}))
+
+	policy := retry.PolicyFromParams(input.ExtraInputs)
+	policy.OnRetry = func(operation string, attempt int, err error, _ time.Duration) {
+		logger.Error("[result delivery] rpc failed", zap.String("operation", operation), zap.Int("attempt", attempt), zap.Error(err))
+	}
+
+	logger.Info("Setting job in progress")
+	_, err = retry.Do(grpcCtx, policy, "SetInProgress", func(ctx context.Context) (*golang.ResponseOK, error) {
+		return client.SetInProgress(ctx, &golang.SetInProgressRequest{
+			JobId: uint32(input.DescribeJob.JobID),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	resourceIds, err := describeWorkerInput(ctx, logger, input, token)
+	logger.Info("Resource IDs fetched", zap.Int("count", len(resourceIds)))
+
+	errMsg := ""
+	errCode := ""
+	status := DescribeResourceJobSucceeded
+	if err != nil {
+		errMsg = err.Error()
+		var kerr Error
+		if errors.As(err, &kerr) {
+			errCode = kerr.ErrCode
+		}
+		status = DescribeResourceJobFailed
+	}
+
+	logger.Info("Delivering result", zap.String("status", status))
+	// The result is delivered even when ctx is done, otherwise the job would
+	// stay in progress until the describe service times it out.
+	deliverCtx := metadata.NewOutgoingContext(context.WithoutCancel(ctx), metadata.New(map[string]string{}))
+	_, err = retry.Do(deliverCtx, policy, "DeliverResult", func(ctx context.Context) (*golang.ResponseOK, error) {
+		return client.DeliverResult(ctx, &golang.DeliverResultRequest{
+			JobId:     uint32(input.DescribeJob.JobID),
+			Status:    status,
+			Error:     errMsg,
+			ErrorCode: errCode,
+			DescribeJob: &golang.DescribeJob{
+				JobId:           uint32(input.DescribeJob.JobID),
+				ResourceType:    input.DescribeJob.ResourceType,
+				IntegrationId:   input.DescribeJob.IntegrationID,
+				ProviderId:      input.DescribeJob.ProviderID,
+				DescribedAt:     input.DescribeJob.DescribedAt,
+				IntegrationType: string(input.DescribeJob.IntegrationType),
+				ConfigReg:       input.DescribeJob.CipherText,
+				TriggerType:     string(input.DescribeJob.TriggerType),
+				RetryCounter:    uint32(input.DescribeJob.RetryCounter),
+			},
+			DescribedResourceIds: resourceIds,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("[result delivery] failed to deliver result: %w", err)
+	}
+
+	logger.Info("job done", zap.Uint("jobID", input.DescribeJob.JobID))
+	return nil
+}
+
+func describeWorkerInput(ctx context.Context, logger *zap.Logger, input describepkg.DescribeWorkerInput, token string) (resourceIDs []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("paniced with error: %v", r)
+			logger.Error("paniced with error", zap.Error(err))
+		}
+	}()
+
+	credentialSrc, err := credentials.NewCredentialSource(ctx, logger, input.VaultConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize credential source: %w", err)
+	}
+	config, err := credentialSrc.Decrypt(ctx, input.DescribeJob.CipherText)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt error: %w", err)
+	}
+
+	for k, v := range input.ExtraInputs {
+		ctx = context.WithValue(ctx, k, v)
+	}
+
+	var opts []DescribeOption
+	stateStore, err := ResourceStateStoreFromParams(input.ExtraInputs, nil)
+	if err != nil {
+		return nil, err
+	}
+	if stateStore != nil {
+		opts = append(opts, WithResourceStateStore(stateStore))
+	}
+	// The handler has no es client to list the indexed resources, without a
+	// state store the describe fails with ErrNoKnownResources instead of
+	// skipping the deletions silently.
+	if deletions, _ := strconv.ParseBool(input.ExtraInputs["deletion_detection"]); deletions {
+		opts = append(opts, WithDeletionDetection())
+	}
+
+	stats := model.NewDescribeStats()
+	ctx = describers.WithStats(ctx, stats)
+	startedAt := time.Now()
+	defer func() {
+		snapshot := stats.Snapshot()
+		logger.Info("describe stats", zap.String("resourceType", input.DescribeJob.ResourceType),
+			zap.Duration("duration", time.Since(startedAt)), zap.Int64("pages", snapshot.Pages),
+			zap.Int64("api_calls", snapshot.APICalls), zap.Int64("retries", snapshot.Retries),
+			zap.Duration("throttle_wait", snapshot.ThrottleWait), zap.Int64("bytes_sent", snapshot.BytesSent),
+			zap.Duration("send_blocked", snapshot.SendBlocked))
+	}()
+
+	return Describe(ctx, logger, input.DescribeJob, input.ExtraInputs, config, input.DeliverEndpoint,
+		input.IngestionPipelineEndpoint, token, input.UseOpenSearch, opts...)
+}
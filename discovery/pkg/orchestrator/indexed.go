@@ -0,0 +1,92 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/opengovern/og-describer-template/global/constants"
+	"github.com/opengovern/og-util/pkg/es"
+	"github.com/opengovern/og-util/pkg/opengovernance-es-sdk"
+)
+
+type indexedResource struct {
+	PlatformID      string            `json:"platform_id"`
+	ResourceID      string            `json:"resource_id"`
+	ResourceName    string            `json:"resource_name"`
+	ResourceType    string            `json:"resource_type"`
+	IntegrationType string            `json:"integration_type"`
+	IntegrationID   string            `json:"integration_id"`
+	Metadata        map[string]string `json:"metadata"`
+}
+
+type indexedResourceHit struct {
+	ID     string          `json:"_id"`
+	Index  string          `json:"_index"`
+	Source indexedResource `json:"_source"`
+	Sort   []interface{}   `json:"sort"`
+}
+
+type indexedResourceSearchResponse struct {
+	PitID string `json:"pit_id"`
+	Hits  struct {
+		Total opengovernance.SearchTotal `json:"total"`
+		Hits  []indexedResourceHit       `json:"hits"`
+	} `json:"hits"`
+}
+
+// IndexedResources returns the resources of an (integration, resource type)
+// pair currently indexed, keyed by PlatformID. The lookup documents are
+// derived the same way the ResourceSender builds them.
+func IndexedResources(ctx context.Context, client opengovernance.Client, integrationID, resourceType string) (map[string]ResourceState, error) {
+	resourceType = strings.ToLower(resourceType)
+	_, index := es.Resource{
+		IntegrationType: constants.IntegrationName,
+		ResourceType:    resourceType,
+	}.KeysAndIndex()
+
+	paginator, err := opengovernance.NewPaginator(client.ES(), index, []opengovernance.BoolFilter{
+		opengovernance.NewTermFilter("integration_id", integrationID),
+		opengovernance.NewTermFilter("resource_type", resourceType),
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query indexed resources: %w", err)
+	}
+	defer paginator.Deallocate(ctx)
+
+	states := make(map[string]ResourceState)
+	for !paginator.Done() {
+		var response indexedResourceSearchResponse
+		if err := paginator.Search(ctx, &response); err != nil {
+			return nil, fmt.Errorf("failed to query indexed resources: %w", err)
+		}
+		for _, hit := range response.Hits.Hits {
+			src := hit.Source
+			lookupKeys, lookupIdx := es.LookupResource{
+				PlatformID:      src.PlatformID,
+				ResourceID:      src.ResourceID,
+				ResourceName:    src.ResourceName,
+				IntegrationType: constants.IntegrationName,
+				ResourceType:    resourceType,
+				IntegrationID:   src.IntegrationID,
+			}.KeysAndIndex()
+			states[src.PlatformID] = ResourceState{
+				PlatformID: src.PlatformID,
+				ResourceID: src.ResourceID,
+				Hash:       src.Metadata[ContentHashKey],
+				Docs: []DocRef{
+					{ID: hit.ID, Index: hit.Index},
+					{ID: es.HashOf(lookupKeys...), Index: lookupIdx},
+				},
+			}
+		}
+
+		hits := int64(len(response.Hits.Hits))
+		if hits > 0 {
+			paginator.UpdateState(hits, response.Hits.Hits[hits-1].Sort, response.PitID)
+		} else {
+			paginator.UpdateState(hits, nil, "")
+		}
+	}
+	return states, nil
+}
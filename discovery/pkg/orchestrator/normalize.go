@@ -0,0 +1,44 @@
+package orchestrator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/opengovern/og-describer-template/discovery/pkg/normalize"
+)
+
+// RedactedFieldsKey is the resource metadata key listing the redacted
+// description fields, comma separated.
+const RedactedFieldsKey = "redacted_fields"
+
+// Normalizer returns the description pipeline of a resource type, the default
+// steps with the redaction rules of resource-types.json running before
+// Truncate, so they always see the full value of a secret. The returned
+// key identifies the rules, it is part of the content hash so resources are
+// sent again when the rules change.
+func Normalizer(resourceType string) (*normalize.Pipeline, string, error) {
+	rt, err := GetResourceType(resourceType)
+	if err != nil || len(rt.Redactions) == 0 {
+		return normalize.Default(), "", nil
+	}
+
+	rules := make([]normalize.RedactionRule, 0, len(rt.Redactions))
+	for _, r := range rt.Redactions {
+		rules = append(rules, normalize.RedactionRule{Field: r.Field, Pattern: r.Pattern, Action: r.Action})
+	}
+	redaction, err := normalize.Redaction(rules)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid redaction rules of %s: %w", resourceType, err)
+	}
+
+	content, err := json.Marshal(rules)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(content)
+	pipeline := normalize.New(normalize.TrimEmpty(), redaction,
+		normalize.Truncate(normalize.DefaultMaxStringBytes), normalize.CanonicalTimestamps())
+	return pipeline, hex.EncodeToString(sum[:]), nil
+}
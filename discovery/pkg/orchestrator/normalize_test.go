@@ -0,0 +1,36 @@
+package orchestrator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opengovern/og-describer-template/discovery/pkg/normalize"
+)
+
+// TestNormalizerRedactsBeforeTruncating cuts the description at the middle of
+// a secret, which must still be redacted as a whole.
+func TestNormalizerRedactsBeforeTruncating(t *testing.T) {
+	pipeline, key, err := Normalizer("Github/Artifact/DockerFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key == "" {
+		t.Fatal("no redaction rules for Github/Artifact/DockerFile")
+	}
+
+	prefix := "FROM x\n" + strings.Repeat("#", normalize.DefaultMaxStringBytes-20) + "\n"
+	secret := strings.Repeat("s", 100)
+	content := prefix + `ENV TOKEN="` + secret + `"` + "\nRUN make"
+
+	result, err := pipeline.Normalize(map[string]any{"DockerfileContent": content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := result.Description.(map[string]any)["DockerfileContent"].(string)
+	if strings.Contains(got, "ssss") {
+		t.Errorf("part of the secret was left in the truncated content: %q", got[len(prefix):])
+	}
+	if len(result.Report.Redacted) != 1 || result.Report.Redacted[0] != "DockerfileContent" {
+		t.Errorf("Redacted = %v, want [DockerfileContent]", result.Report.Redacted)
+	}
+}
@@ -2,24 +2,18 @@ package orchestrator
 
 import (
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	model "github.com/opengovern/og-describer-template/discovery/pkg/models"
+	"github.com/opengovern/og-describer-template/discovery/pkg/retry"
 	"github.com/opengovern/og-describer-template/global/constants"
 	"github.com/opengovern/og-util/pkg/es"
-	"github.com/opengovern/og-util/proto/src/golang"
 	"go.uber.org/zap"
-	"golang.org/x/oauth2"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/credentials/oauth"
-	"google.golang.org/grpc/metadata"
-	"google.golang.org/protobuf/types/known/anypb"
-	"io"
-	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -28,129 +22,462 @@ const (
 	MaxBufferSize   int           = 100
 	ChannelSize     int           = 1000
 	BufferEmptyRate time.Duration = 5 * time.Second
+
+	// DefaultMaxBatchBytes keeps a batch below the default 4MB gRPC message
+	// limit, MinBatchBytes bounds how far it shrinks on ResourceExhausted.
+	DefaultMaxBatchBytes int = 3 * 1024 * 1024
+	MinBatchBytes        int = 64 * 1024
+
+	// DefaultMaxInFlight is the number of Ingest calls running at the same time.
+	DefaultMaxInFlight int = 4
+
+	// DefaultIngestTimeout bounds a single Ingest call, so a hung sink cannot
+	// hold Finish and the describe deadline forever.
+	DefaultIngestTimeout time.Duration = time.Minute
 )
 
+// batchConfig controls when buffered resources are sent. A batch is sent once
+// it holds maxResources resources or maxBytes of serialized documents, and on
+// every flushInterval tick once it holds at least minResources.
+type batchConfig struct {
+	minResources  int
+	maxResources  int
+	maxBytes      int
+	flushInterval time.Duration
+	maxInFlight   int
+	ingestTimeout time.Duration
+}
+
+// batchConfigFromParams reads the sink_batch_min_resources,
+// sink_batch_max_resources, sink_batch_max_bytes, sink_flush_interval,
+// sink_max_in_flight and sink_ingest_timeout params.
+func batchConfigFromParams(params map[string]string) batchConfig {
+	cfg := batchConfig{
+		minResources:  MinBufferSize,
+		maxResources:  MaxBufferSize,
+		maxBytes:      DefaultMaxBatchBytes,
+		flushInterval: BufferEmptyRate,
+		maxInFlight:   DefaultMaxInFlight,
+		ingestTimeout: DefaultIngestTimeout,
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(params["sink_batch_min_resources"])); err == nil && n > 0 {
+		cfg.minResources = n
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(params["sink_batch_max_resources"])); err == nil && n > 0 {
+		cfg.maxResources = n
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(params["sink_batch_max_bytes"])); err == nil && n >= MinBatchBytes {
+		cfg.maxBytes = n
+	}
+	if d, err := time.ParseDuration(strings.TrimSpace(params["sink_flush_interval"])); err == nil && d > 0 {
+		cfg.flushInterval = d
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(params["sink_max_in_flight"])); err == nil && n > 0 {
+		cfg.maxInFlight = n
+	}
+	if d, err := time.ParseDuration(strings.TrimSpace(params["sink_ingest_timeout"])); err == nil && d > 0 {
+		cfg.ingestTimeout = d
+	}
+	if cfg.minResources > cfg.maxResources {
+		cfg.minResources = cfg.maxResources
+	}
+	return cfg
+}
+
 type ResourceSender struct {
-	authToken                 string
-	logger                    *zap.Logger
-	resourceChannel           chan *es.Resource
-	resourceIDs               []string
-	doneChannel               chan interface{}
-	conn                      *grpc.ClientConn
-	grpcEndpoint              string
-	ingestionPipelineEndpoint string
-	jobID                     uint
-	params                    map[string]string
+	logger          *zap.Logger
+	resourceChannel chan *sendItem
+	resourceIDs     []string
+	doneChannel     chan interface{}
+	jobID           uint
+	params          map[string]string
+	sink            Sink
+
+	// finished is closed by Finish, a later Send is dropped instead of
+	// blocking forever on the channel nobody reads anymore.
+	finished chan struct{}
+
+	batch             batchConfig
+	sendBuffer        []SinkDoc
+	bufferedResources int
+	bufferedBytes     int
 
-	client     golang.EsSinkServiceClient
-	httpClient *http.Client
+	stats *model.DescribeStats
 
-	sendBuffer    []*es.Resource
-	useOpenSearch bool
+	// spool holds the batches the sink rejected, it is created on the first
+	// failure and replayed with backoff from the ResourceHandler goroutine.
+	spool             *spool
+	spoolPolicy       retry.Policy
+	spoolDrainTimeout time.Duration
+	spoolAttempt      int
+	nextSpoolReplay   time.Time
+
+	// Batches are sent by up to batch.maxInFlight ingest goroutines. Their
+	// results are settled in dispatch order, so failed batches reach the
+	// spool in the order they were built.
+	inFlight       int
+	nextSeq        uint64
+	settledSeq     uint64
+	results        chan ingestResult
+	pendingResults map[uint64]ingestResult
+	sendBlocked    atomic.Int64
+
+	// mu guards the batch size and the delivery counters, which the ingest
+	// goroutines update. The counters are read after Finish.
+	mu                 sync.Mutex
+	ackedDocs          int
+	failedDocs         int
+	deliveredResources int
+}
+
+// sendItem is either a resource or the tombstones of a deleted resource.
+type sendItem struct {
+	resource   *es.Resource
+	tombstones []SinkDoc
+}
+
+type ingestResult struct {
+	seq  uint64
+	docs []SinkDoc
+	sent int
+	err  error
+}
+
+// DeliveryError is returned when the sink did not acknowledge every document
+// of the described resources.
+type DeliveryError struct {
+	ResourceType string
+	Described    int
+	Delivered    int
+	FailedDocs   int
 }
 
-func NewResourceSender(grpcEndpoint, ingestionPipelineEndpoint string, describeToken string, jobID uint, params map[string]string, useOpenSearch bool, logger *zap.Logger) (*ResourceSender, error) {
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("delivered %d of %d described %s resources to the sink (%d documents failed)",
+		e.Delivered, e.Described, e.ResourceType, e.FailedDocs)
+}
+
+// NewResourceSenderWithSink sends to the given sink, which is closed by Finish.
+func NewResourceSenderWithSink(sink Sink, jobID uint, params map[string]string, stats *model.DescribeStats, logger *zap.Logger) *ResourceSender {
 	rs := ResourceSender{
-		authToken:                 describeToken,
-		logger:                    logger,
-		resourceChannel:           make(chan *es.Resource, ChannelSize),
-		resourceIDs:               nil,
-		doneChannel:               make(chan interface{}),
-		conn:                      nil,
-		grpcEndpoint:              grpcEndpoint,
-		ingestionPipelineEndpoint: ingestionPipelineEndpoint,
-		jobID:                     jobID,
-		params:                    params,
-		useOpenSearch:             useOpenSearch,
+		logger:          logger,
+		resourceChannel: make(chan *sendItem, ChannelSize),
+		resourceIDs:     nil,
+		doneChannel:     make(chan interface{}),
+		finished:        make(chan struct{}),
+		jobID:           jobID,
+		params:          params,
+		sink:            sink,
+		stats:           stats,
 
-		httpClient: &http.Client{Timeout: 10 * time.Second},
+		batch:             batchConfigFromParams(params),
+		spoolPolicy:       retry.PolicyFromParams(params),
+		spoolDrainTimeout: DefaultSpoolDrainTimeout,
 	}
-	if err := rs.Connect(); err != nil {
-		return nil, err
+	if d, err := time.ParseDuration(strings.TrimSpace(params["sink_spool_drain_timeout"])); err == nil && d >= 0 {
+		rs.spoolDrainTimeout = d
 	}
+	rs.results = make(chan ingestResult, rs.batch.maxInFlight)
+	rs.pendingResults = make(map[uint64]ingestResult)
+	rs.adoptOrphanSpools()
 
 	go rs.ResourceHandler()
-	return &rs, nil
-}
-
-func (s *ResourceSender) Connect() error {
-	var opts []grpc.DialOption
-	if s.authToken != "" {
-		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})))
-		opts = append(opts, grpc.WithPerRPCCredentials(oauth.TokenSource{
-			TokenSource: oauth2.StaticTokenSource(&oauth2.Token{
-				AccessToken: s.authToken,
-			}),
-		}))
-	} else {
-		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	}
-
-	conn, err := grpc.NewClient(
-		s.grpcEndpoint,
-		opts...,
-	)
-	if err != nil {
-		return err
-	}
-	s.conn = conn
-
-	client := golang.NewEsSinkServiceClient(conn)
-	s.client = client
-	return nil
+	return &rs
 }
 
 func (s *ResourceSender) ResourceHandler() {
-	t := time.NewTicker(BufferEmptyRate)
+	t := time.NewTicker(s.batch.flushInterval)
 	defer t.Stop()
 
 	for {
 		select {
-		case resource := <-s.resourceChannel:
-			if resource == nil {
+		case item := <-s.resourceChannel:
+			if item == nil {
 				s.flushBuffer(true)
+				s.waitInFlight()
+				s.drainSpool()
 				s.doneChannel <- struct{}{}
 				return
 			}
 
-			s.resourceIDs = append(s.resourceIDs, resource.ResourceID)
-			s.sendBuffer = append(s.sendBuffer, resource)
+			docs := item.tombstones
+			if item.resource != nil {
+				s.resourceIDs = append(s.resourceIDs, item.resource.ResourceID)
+				docs = s.buildDocs(item.resource)
+			}
+			size := docsSize(docs)
+			maxBytes := s.maxBatchBytes()
+			if s.bufferedBytes > 0 && s.bufferedBytes+size > maxBytes {
+				s.flushBuffer(true)
+			}
+			s.sendBuffer = append(s.sendBuffer, docs...)
+			s.bufferedResources++
+			s.bufferedBytes += size
 
-			if len(s.sendBuffer) > MaxBufferSize {
+			if s.bufferedResources >= s.batch.maxResources || s.bufferedBytes >= maxBytes {
 				s.flushBuffer(true)
 			}
+		case r := <-s.results:
+			s.settle(r)
 		case <-t.C:
 			s.flushBuffer(false)
+			s.replaySpool()
 		}
 	}
 }
 
-func (s *ResourceSender) sendToBackend(resourcesToSend []es.Doc) {
-	grpcCtx := metadata.NewOutgoingContext(context.Background(), metadata.New(map[string]string{
-		"resource-job-id": fmt.Sprintf("%d", s.jobID),
-	}))
+func (s *ResourceSender) sendToBackend(docs []SinkDoc) {
+	// Keep the order of delivery while older batches wait in the spool. The
+	// documents of adopted spools are from another run and need not go first.
+	if s.spool != nil && s.spool.Pending() > s.spool.PendingOrphans() {
+		s.spoolDocs(docs)
+		return
+	}
+	s.dispatch(docs)
+}
 
-	docs := make([]*anypb.Any, 0, len(resourcesToSend))
-	for _, resource := range resourcesToSend {
-		docBytes, err := json.Marshal(resource)
-		if err != nil {
-			s.logger.Error("failed to marshal resource", zap.Error(err))
+// dispatch sends docs from a new ingest goroutine, first waiting for a free
+// slot when batch.maxInFlight calls are already running.
+func (s *ResourceSender) dispatch(docs []SinkDoc) {
+	for s.inFlight >= s.batch.maxInFlight {
+		s.settle(<-s.results)
+	}
+	seq := s.nextSeq
+	s.nextSeq++
+	s.inFlight++
+	go func() {
+		n, err := s.ingest(docs, true)
+		s.results <- ingestResult{seq: seq, docs: docs, sent: n, err: err}
+	}()
+}
+
+// settle records a finished ingest call. Results are handled in dispatch
+// order, a result arriving early waits until the ones before it are in.
+func (s *ResourceSender) settle(r ingestResult) {
+	s.inFlight--
+	s.pendingResults[r.seq] = r
+	for {
+		next, ok := s.pendingResults[s.settledSeq]
+		if !ok {
+			return
+		}
+		delete(s.pendingResults, s.settledSeq)
+		s.settledSeq++
+		if next.err == nil {
+			continue
+		}
+		failed := next.docs[next.sent:]
+		if !retry.IsRetryable(next.err) {
+			s.logger.Error("sink rejected batch, dropping it", zap.Uint64("batch", next.seq),
+				zap.Int("docs", len(failed)), zap.Error(next.err))
+			s.countFailed(len(failed))
 			continue
 		}
-		docs = append(docs, &anypb.Any{Value: docBytes})
+		s.logger.Error("failed to send resource", zap.Uint64("batch", next.seq), zap.Error(next.err))
+		s.spoolDocs(failed)
 	}
+}
+
+func (s *ResourceSender) waitInFlight() {
+	for s.inFlight > 0 {
+		s.settle(<-s.results)
+	}
+}
 
-	_, err := s.client.Ingest(grpcCtx, &golang.IngestRequest{Docs: docs})
+// ingest sends docs in a single Ingest call and returns how many leading
+// documents were consumed. When the sink rejects the batch as too large it is
+// split in half, and later batches are kept below the rejected size. Only own
+// documents are counted as delivered or failed, not those of adopted spools.
+func (s *ResourceSender) ingest(docs []SinkDoc, own bool) (int, error) {
+	size := 0
+	resources := 0
+	for _, doc := range docs {
+		size += len(doc.Data)
+		if doc.Resource {
+			resources++
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.batch.ingestTimeout)
+	err := s.sink.Ingest(ctx, docs)
+	if err != nil && ctx.Err() != nil {
+		// The sink did not answer within ingestTimeout, try again later.
+		err = retry.Retryable(err)
+	}
+	cancel()
 	if err != nil {
-		s.logger.Error("failed to send resource", zap.Error(err))
-		if errors.Is(err, io.EOF) {
-			err = s.Connect()
+		if errors.Is(err, ErrBatchTooLarge) {
+			if len(docs) == 1 {
+				// A single document the sink will never accept would block the
+				// spool behind it, so it is dropped.
+				s.logger.Error("document too large for the sink, dropping it", zap.Int("bytes", size), zap.Error(err))
+				if own {
+					s.countFailed(1)
+				}
+				return 1, nil
+			}
+			s.shrinkBatch(size)
+			mid := len(docs) / 2
+			n, err := s.ingest(docs[:mid], own)
 			if err != nil {
-				s.logger.Error("failed to reconnect", zap.Error(err))
+				return n, err
 			}
+			n, err = s.ingest(docs[mid:], own)
+			return mid + n, err
+		}
+		return 0, err
+	}
+	s.stats.AddBytesSent(size)
+	if !own {
+		return len(docs), nil
+	}
+	s.mu.Lock()
+	s.ackedDocs += len(docs)
+	s.deliveredResources += resources
+	s.mu.Unlock()
+	return len(docs), nil
+}
+
+func (s *ResourceSender) countFailed(docs int) {
+	s.mu.Lock()
+	s.failedDocs += docs
+	s.mu.Unlock()
+}
+
+func (s *ResourceSender) maxBatchBytes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batch.maxBytes
+}
+
+func (s *ResourceSender) shrinkBatch(rejectedSize int) {
+	maxBytes := rejectedSize / 2
+	if maxBytes < MinBatchBytes {
+		maxBytes = MinBatchBytes
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if maxBytes < s.batch.maxBytes {
+		s.logger.Warn("sink rejected batch size, lowering it", zap.Int("rejected_bytes", rejectedSize), zap.Int("max_batch_bytes", maxBytes))
+		s.batch.maxBytes = maxBytes
+	}
+}
+
+// adoptOrphanSpools takes over the spools left behind by crashed senders, so
+// their documents are replayed first. Failing to do so is only logged.
+func (s *ResourceSender) adoptOrphanSpools() {
+	orphans := staleSpools(spoolRoot(s.params), time.Now().Add(-spoolStaleAfter))
+	if len(orphans) == 0 {
+		return
+	}
+	sp, err := newSpool(s.jobID, s.params)
+	if err != nil {
+		s.logger.Warn("failed to create spool for orphaned spools", zap.Error(err))
+		return
+	}
+	n, err := sp.Adopt(orphans)
+	if err != nil {
+		s.logger.Warn("failed to adopt some orphaned spools", zap.Error(err))
+	}
+	if n == 0 {
+		if err := sp.Close(); err != nil {
+			s.logger.Warn("failed to close spool", zap.Error(err))
 		}
 		return
 	}
+	s.logger.Info("replaying documents spooled by a crashed sender", zap.Int("docs", n))
+	s.spool = sp
+}
+
+// spoolDocs stores a failed batch on disk. If even that fails, or the spool
+// is full, the documents are lost and counted as failed.
+func (s *ResourceSender) spoolDocs(docs []SinkDoc) {
+	if s.spool == nil {
+		sp, err := newSpool(s.jobID, s.params)
+		if err != nil {
+			s.logger.Error("failed to create spool, dropping batch", zap.Error(err), zap.Int("docs", len(docs)))
+			s.countFailed(len(docs))
+			return
+		}
+		s.spool = sp
+		s.nextSpoolReplay = time.Now().Add(s.spoolPolicy.Backoff(1))
+	}
+	if err := s.spool.Append(docs); err != nil {
+		s.logger.Error("failed to spool batch, dropping it", zap.Error(err), zap.Int("docs", len(docs)))
+		s.countFailed(len(docs))
+	}
+}
+
+// replaySpool sends the spooled batches once their backoff has passed.
+func (s *ResourceSender) replaySpool() {
+	if s.spool == nil {
+		return
+	}
+	s.spool.Touch()
+	if s.spool.Pending() == 0 || time.Now().Before(s.nextSpoolReplay) {
+		return
+	}
+	for s.spool.Pending() > 0 {
+		if err := s.spool.Replay(s.replayBatch, s.maxBatchBytes()); err != nil {
+			s.spoolAttempt++
+			delay := s.spoolPolicy.Backoff(s.spoolAttempt)
+			s.nextSpoolReplay = time.Now().Add(delay)
+			s.logger.Warn("failed to replay spooled resources", zap.Error(err),
+				zap.Int("pending", s.spool.Pending()), zap.Duration("next_attempt_in", delay))
+			return
+		}
+	}
+	s.spoolAttempt = 0
+}
+
+// replayBatch sends a spooled batch. A batch the sink rejected for good is
+// dropped, it would block the rest of the spool.
+func (s *ResourceSender) replayBatch(docs []SinkDoc, orphan bool) (int, error) {
+	n, err := s.ingest(docs, !orphan)
+	if err == nil || retry.IsRetryable(err) {
+		return n, err
+	}
+	s.logger.Error("sink rejected spooled batch, dropping it", zap.Int("docs", len(docs)-n), zap.Error(err))
+	if !orphan {
+		s.countFailed(len(docs) - n)
+	}
+	return len(docs), nil
+}
+
+// drainSpool replays the spool until it is empty or spoolDrainTimeout passed.
+// Whatever is left is counted as failed and removed with the spool, except
+// the documents of adopted spools, which are left for the next sender.
+func (s *ResourceSender) drainSpool() {
+	if s.spool == nil {
+		return
+	}
+	deadline := time.Now().Add(s.spoolDrainTimeout)
+	for s.spool.Pending() > 0 {
+		s.spool.Touch()
+		err := s.spool.Replay(s.replayBatch, s.maxBatchBytes())
+		if err == nil {
+			continue
+		}
+		s.spoolAttempt++
+		delay := s.spoolPolicy.Backoff(s.spoolAttempt)
+		if time.Now().Add(delay).After(deadline) {
+			s.logger.Error("failed to drain spool before deadline", zap.Error(err))
+			break
+		}
+		time.Sleep(delay)
+	}
+
+	orphans := s.spool.PendingOrphans()
+	if pending := s.spool.Pending() - orphans; pending > 0 {
+		s.countFailed(pending)
+		s.logger.Error("dropping resources left undelivered in spool", zap.Int("docs", pending))
+	}
+	if orphans > 0 {
+		s.logger.Warn("leaving orphaned spooled documents to the next sender", zap.Int("docs", orphans))
+	}
+	if err := s.spool.Close(); err != nil {
+		s.logger.Warn("failed to close spool", zap.Error(err))
+	}
 }
 
 func (s *ResourceSender) flushBuffer(force bool) {
@@ -158,54 +485,126 @@ func (s *ResourceSender) flushBuffer(force bool) {
 		return
 	}
 
-	if !force && len(s.sendBuffer) < MinBufferSize {
+	if !force && s.bufferedResources < s.batch.minResources {
 		return
 	}
 
-	resourcesToSend := make([]es.Doc, 0, 2*len(s.sendBuffer))
-
-	for _, resource := range s.sendBuffer {
-		kafkaResource := resource
-		keys, idx := kafkaResource.KeysAndIndex()
-		kafkaResource.EsID = es.HashOf(keys...)
-		kafkaResource.EsIndex = idx
-
-		lookupResource := es.LookupResource{
-			PlatformID:      resource.PlatformID,
-			ResourceID:      resource.ResourceID,
-			ResourceName:    resource.ResourceName,
-			IntegrationType: constants.IntegrationName,
-			ResourceType:    strings.ToLower(resource.ResourceType),
-			Metadata: es.LookupResourceMetadata{
-				Parameters: es.ConvertMapToString(s.params),
-			},
-			IntegrationID: resource.IntegrationID,
-			DescribedBy:   resource.DescribedBy,
-			DescribedAt:   resource.DescribedAt,
-			Tags:          resource.CanonicalTags,
+	s.sendToBackend(s.sendBuffer)
+	s.sendBuffer = nil
+	s.bufferedResources = 0
+	s.bufferedBytes = 0
+}
+
+// buildDocs serializes the resource document and its lookup document.
+func (s *ResourceSender) buildDocs(resource *es.Resource) []SinkDoc {
+	docs := make([]SinkDoc, 0, 2)
+	for _, doc := range resourceDocs(resource, s.params) {
+		docBytes, err := json.Marshal(doc)
+		if err != nil {
+			s.logger.Error("failed to marshal resource", zap.Error(err))
+			s.countFailed(1)
+			continue
 		}
-		lookupKeys, lookupIdx := lookupResource.KeysAndIndex()
-		lookupResource.EsID = es.HashOf(lookupKeys...)
-		lookupResource.EsIndex = lookupIdx
+		_, isResource := doc.(*es.Resource)
+		keys, idx := doc.KeysAndIndex()
+		docs = append(docs, SinkDoc{
+			Resource: isResource,
+			ID:       es.HashOf(keys...),
+			Index:    idx,
+			Data:     docBytes,
+		})
+	}
+	return docs
+}
 
-		resourcesToSend = append(resourcesToSend, kafkaResource)
-		resourcesToSend = append(resourcesToSend, lookupResource)
+// resourceDocs returns the documents indexed for a resource: the resource
+// itself and its lookup entry.
+func resourceDocs(resource *es.Resource, params map[string]string) []es.Doc {
+	keys, idx := resource.KeysAndIndex()
+	resource.EsID = es.HashOf(keys...)
+	resource.EsIndex = idx
+
+	lookupResource := es.LookupResource{
+		PlatformID:      resource.PlatformID,
+		ResourceID:      resource.ResourceID,
+		ResourceName:    resource.ResourceName,
+		IntegrationType: constants.IntegrationName,
+		ResourceType:    strings.ToLower(resource.ResourceType),
+		Metadata: es.LookupResourceMetadata{
+			Parameters: es.ConvertMapToString(params),
+		},
+		IntegrationID: resource.IntegrationID,
+		DescribedBy:   resource.DescribedBy,
+		DescribedAt:   resource.DescribedAt,
+		Tags:          resource.CanonicalTags,
 	}
+	lookupKeys, lookupIdx := lookupResource.KeysAndIndex()
+	lookupResource.EsID = es.HashOf(lookupKeys...)
+	lookupResource.EsIndex = lookupIdx
 
-	s.sendToBackend(resourcesToSend)
-	s.sendBuffer = nil
+	return []es.Doc{resource, lookupResource}
 }
 
-func (s *ResourceSender) Finish() {
+func docsSize(docs []SinkDoc) int {
+	size := 0
+	for _, doc := range docs {
+		size += len(doc.Data)
+	}
+	return size
+}
+
+// Finish flushes the buffered resources, drains the spool and closes the
+// sink. A *DeliveryError is returned when some documents never reached
+// the sink.
+func (s *ResourceSender) Finish() error {
 	s.resourceChannel <- nil
 	_ = <-s.doneChannel
-	s.conn.Close()
+	close(s.finished)
+	if err := s.sink.Close(); err != nil {
+		s.logger.Warn("failed to close sink", zap.Error(err))
+	}
+
+	s.logger.Info("resource sender finished", zap.Int("acked_docs", s.ackedDocs), zap.Int("failed_docs", s.failedDocs),
+		zap.Int("batches", int(s.nextSeq)), zap.Duration("send_blocked", time.Duration(s.sendBlocked.Load())))
+	if s.failedDocs > 0 || s.deliveredResources < len(s.resourceIDs) {
+		return &DeliveryError{
+			Described:  len(s.resourceIDs),
+			Delivered:  s.deliveredResources,
+			FailedDocs: s.failedDocs,
+		}
+	}
+	return nil
 }
 
 func (s *ResourceSender) GetResourceIDs() []string {
 	return s.resourceIDs
 }
 
+// Send queues a resource. It blocks while the channel is full, the time spent
+// waiting is reported as backpressure in the describe stats. Resources sent
+// after Finish are dropped.
 func (s *ResourceSender) Send(resource *es.Resource) {
-	s.resourceChannel <- resource
+	s.enqueue(&sendItem{resource: resource})
+}
+
+// SendTombstones queues the tombstones of a resource that no longer exists.
+func (s *ResourceSender) SendTombstones(docs []SinkDoc) {
+	s.enqueue(&sendItem{tombstones: docs})
+}
+
+func (s *ResourceSender) enqueue(item *sendItem) {
+	select {
+	case s.resourceChannel <- item:
+		return
+	default:
+	}
+	start := time.Now()
+	select {
+	case s.resourceChannel <- item:
+	case <-s.finished:
+		return
+	}
+	blocked := time.Since(start)
+	s.sendBlocked.Add(int64(blocked))
+	s.stats.AddSendBlocked(blocked)
 }
@@ -0,0 +1,314 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opengovern/og-describer-template/discovery/pkg/retry"
+	"github.com/opengovern/og-util/pkg/es"
+	"go.uber.org/zap"
+)
+
+// fakeSink keeps the documents of every Ingest call fail lets through.
+type fakeSink struct {
+	MemorySink
+
+	mu    sync.Mutex
+	calls int
+	fail  func(call int, docs []SinkDoc) error
+}
+
+func (s *fakeSink) Ingest(ctx context.Context, docs []SinkDoc) error {
+	s.mu.Lock()
+	s.calls++
+	call := s.calls
+	s.mu.Unlock()
+	if s.fail != nil {
+		if err := s.fail(call, docs); err != nil {
+			return err
+		}
+	}
+	return s.MemorySink.Ingest(ctx, docs)
+}
+
+func newTestSender(t *testing.T, sink Sink, params map[string]string) *ResourceSender {
+	t.Helper()
+	p := map[string]string{
+		"sink_spool_dir":           t.TempDir(),
+		"sink_flush_interval":      "10ms",
+		"sink_spool_drain_timeout": "2s",
+		"retry_initial_delay":      "1ms",
+		"retry_max_delay":          "5ms",
+	}
+	for k, v := range params {
+		p[k] = v
+	}
+	return NewResourceSenderWithSink(sink, 1, p, nil, zap.NewNop())
+}
+
+func testResource(i int) *es.Resource {
+	return &es.Resource{
+		ResourceID:   fmt.Sprintf("resource-%d", i),
+		ResourceType: "Github/Repository",
+	}
+}
+
+func sendResources(s *ResourceSender, n int) {
+	for i := 0; i < n; i++ {
+		s.Send(testResource(i))
+	}
+}
+
+// resourceIDs returns the resource IDs of the resource documents in docs.
+func resourceIDs(docs []SinkDoc) []string {
+	var ids []string
+	for _, doc := range docs {
+		var r es.Resource
+		if doc.Resource && json.Unmarshal(doc.Data, &r) == nil {
+			ids = append(ids, r.ResourceID)
+		}
+	}
+	return ids
+}
+
+func hasResource(docs []SinkDoc, id string) bool {
+	for _, got := range resourceIDs(docs) {
+		if got == id {
+			return true
+		}
+	}
+	return false
+}
+
+// failOnce fails the first Ingest call carrying the resource with err.
+func failOnce(id string, err error, delay time.Duration) func(int, []SinkDoc) error {
+	var once sync.Once
+	return func(_ int, docs []SinkDoc) error {
+		if !hasResource(docs, id) {
+			return nil
+		}
+		var failed bool
+		once.Do(func() { failed = true })
+		if !failed {
+			return nil
+		}
+		time.Sleep(delay)
+		return err
+	}
+}
+
+func TestResourceSenderDelivers(t *testing.T) {
+	sink := &fakeSink{}
+	s := newTestSender(t, sink, map[string]string{"sink_batch_max_resources": "3"})
+	sendResources(s, 10)
+	if err := s.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(s.GetResourceIDs()); got != 10 {
+		t.Errorf("described %d resources, want 10", got)
+	}
+	if s.deliveredResources != 10 || s.ackedDocs != 20 {
+		t.Errorf("delivered %d resources in %d documents, want 10 in 20", s.deliveredResources, s.ackedDocs)
+	}
+	if got := len(sink.Documents()); got != 20 {
+		t.Errorf("sink got %d documents, want 20", got)
+	}
+}
+
+func TestResourceSenderKeepsOrderOfOutOfOrderFailures(t *testing.T) {
+	// The first batch fails after the second one, both are spooled in the
+	// order they were sent.
+	first := failOnce("resource-0", retry.Retryable(errors.New("sink unavailable")), 50*time.Millisecond)
+	second := failOnce("resource-2", retry.Retryable(errors.New("sink unavailable")), 0)
+	sink := &fakeSink{fail: func(call int, docs []SinkDoc) error {
+		if err := first(call, docs); err != nil {
+			return err
+		}
+		return second(call, docs)
+	}}
+	s := newTestSender(t, sink, map[string]string{"sink_batch_max_resources": "2", "sink_max_in_flight": "2"})
+	sendResources(s, 4)
+	if err := s.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"resource-0", "resource-1", "resource-2", "resource-3"}
+	if got := resourceIDs(sink.Documents()); !reflect.DeepEqual(got, want) {
+		t.Errorf("sink got %v, want %v", got, want)
+	}
+}
+
+func TestResourceSenderSplitsBatchesTooLarge(t *testing.T) {
+	sink := &fakeSink{fail: func(_ int, docs []SinkDoc) error {
+		if len(docs) > 2 {
+			return ErrBatchTooLarge
+		}
+		return nil
+	}}
+	s := newTestSender(t, sink, map[string]string{"sink_batch_max_resources": "4"})
+	sendResources(s, 4)
+	if err := s.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(sink.Documents()); got != 8 {
+		t.Errorf("sink got %d documents, want 8", got)
+	}
+	if s.batch.maxBytes >= DefaultMaxBatchBytes {
+		t.Errorf("max batch bytes not lowered after a rejected batch: %d", s.batch.maxBytes)
+	}
+}
+
+func TestResourceSenderDropsDocumentTooLarge(t *testing.T) {
+	// The sink never takes the resource document of resource-1, it is
+	// dropped alone once the batch is split down to it.
+	sink := &fakeSink{fail: func(_ int, docs []SinkDoc) error {
+		if hasResource(docs, "resource-1") {
+			return ErrBatchTooLarge
+		}
+		return nil
+	}}
+	s := newTestSender(t, sink, map[string]string{"sink_batch_max_resources": "4"})
+	sendResources(s, 4)
+
+	var derr *DeliveryError
+	if err := s.Finish(); !errors.As(err, &derr) {
+		t.Fatalf("Finish() = %v, want a DeliveryError", err)
+	}
+	if derr.Described != 4 || derr.Delivered != 3 || derr.FailedDocs != 1 {
+		t.Errorf("described %d, delivered %d, %d documents failed, want 4, 3 and 1", derr.Described, derr.Delivered, derr.FailedDocs)
+	}
+}
+
+func TestResourceSenderSpoolsPartlySentBatch(t *testing.T) {
+	// The batch is split, the halves before resource-3 go through and only
+	// the rest is spooled, nothing is sent twice.
+	failLast := failOnce("resource-3", retry.Retryable(errors.New("sink unavailable")), 0)
+	sink := &fakeSink{fail: func(call int, docs []SinkDoc) error {
+		if len(docs) > 2 {
+			return ErrBatchTooLarge
+		}
+		return failLast(call, docs)
+	}}
+	s := newTestSender(t, sink, map[string]string{"sink_batch_max_resources": "4"})
+	sendResources(s, 4)
+	if err := s.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"resource-0", "resource-1", "resource-2", "resource-3"}
+	if got := resourceIDs(sink.Documents()); !reflect.DeepEqual(got, want) {
+		t.Errorf("sink got %v, want %v", got, want)
+	}
+	if got := len(sink.Documents()); got != 8 {
+		t.Errorf("sink got %d documents, want 8", got)
+	}
+}
+
+func TestResourceSenderCountsUndrainedSpool(t *testing.T) {
+	sink := &fakeSink{fail: func(int, []SinkDoc) error {
+		return retry.Retryable(errors.New("sink unavailable"))
+	}}
+	s := newTestSender(t, sink, map[string]string{"sink_spool_drain_timeout": "20ms"})
+	sendResources(s, 3)
+
+	var derr *DeliveryError
+	if err := s.Finish(); !errors.As(err, &derr) {
+		t.Fatalf("Finish() = %v, want a DeliveryError", err)
+	}
+	if derr.Described != 3 || derr.Delivered != 0 || derr.FailedDocs != 6 {
+		t.Errorf("described %d, delivered %d, %d documents failed, want 3, 0 and 6", derr.Described, derr.Delivered, derr.FailedDocs)
+	}
+}
+
+func TestResourceSenderDropsPermanentFailures(t *testing.T) {
+	sink := &fakeSink{fail: func(call int, _ []SinkDoc) error {
+		if call == 1 {
+			return errors.New("mapper_parsing_exception")
+		}
+		return nil
+	}}
+	s := newTestSender(t, sink, map[string]string{"sink_batch_max_resources": "2"})
+	sendResources(s, 4)
+
+	var derr *DeliveryError
+	if err := s.Finish(); !errors.As(err, &derr) {
+		t.Fatalf("Finish() = %v, want a DeliveryError", err)
+	}
+	if derr.Described != 4 || derr.Delivered != 2 || derr.FailedDocs != 4 {
+		t.Errorf("described %d, delivered %d, %d documents failed, want 4, 2 and 4", derr.Described, derr.Delivered, derr.FailedDocs)
+	}
+	if s.spool != nil {
+		t.Error("a permanent failure was spooled")
+	}
+}
+
+func TestResourceSenderSpoolsRetryableFailures(t *testing.T) {
+	sink := &fakeSink{fail: func(call int, _ []SinkDoc) error {
+		if call == 1 {
+			return retry.Retryable(errors.New("sink unavailable"))
+		}
+		return nil
+	}}
+	s := newTestSender(t, sink, map[string]string{"sink_batch_max_resources": "2"})
+	sendResources(s, 4)
+
+	if err := s.Finish(); err != nil {
+		t.Fatalf("Finish() = %v, want every resource delivered", err)
+	}
+	if got := len(sink.Documents()); got != 8 {
+		t.Errorf("sink got %d documents, want 8", got)
+	}
+}
+
+func TestResourceSenderReplaysOrphanedSpool(t *testing.T) {
+	root := t.TempDir()
+	crashed, err := newSpool(7, map[string]string{"sink_spool_dir": root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crashed.Append(testDocs(0, 3)); err != nil {
+		t.Fatal(err)
+	}
+	crash(t, crashed)
+
+	sink := &fakeSink{}
+	s := newTestSender(t, sink, map[string]string{"sink_spool_dir": root})
+	sendResources(s, 1)
+	if err := s.Finish(); err != nil {
+		t.Fatalf("Finish() = %v, orphaned documents must not count against the sender", err)
+	}
+
+	got := map[string]bool{}
+	for _, doc := range sink.Documents() {
+		got[doc.ID] = true
+	}
+	for _, id := range docIDs(testDocs(0, 3)) {
+		if !got[id] {
+			t.Errorf("orphaned document %s not replayed", id)
+		}
+	}
+	if s.ackedDocs != 2 {
+		t.Errorf("acked %d documents, want only the 2 of the described resource", s.ackedDocs)
+	}
+}
+
+func TestIngestTimeoutIsRetryable(t *testing.T) {
+	sink := &fakeSink{fail: func(call int, _ []SinkDoc) error {
+		if call == 1 {
+			time.Sleep(50 * time.Millisecond)
+			return context.DeadlineExceeded
+		}
+		return nil
+	}}
+	s := newTestSender(t, sink, map[string]string{"sink_ingest_timeout": "10ms"})
+	sendResources(s, 1)
+	if err := s.Finish(); err != nil {
+		t.Fatalf("Finish() = %v, a timed out batch must be spooled and replayed", err)
+	}
+}
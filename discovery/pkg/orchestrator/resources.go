@@ -10,6 +10,7 @@ import (
 	"github.com/opengovern/og-describer-template/global/maps"
 	"github.com/opengovern/og-util/pkg/describe/enums"
 	"go.uber.org/zap"
+	"path"
 	"sort"
 	"strings"
 )
@@ -43,6 +44,88 @@ func GetResourceTypesMap() map[string]model.ResourceType {
 	return maps.ResourceTypes
 }
 
+// SelectResourceTypes returns the supported resource types that match any of
+// the include patterns and none of the exclude patterns, see FilterResourceTypes.
+func SelectResourceTypes(include, exclude []string) ([]string, error) {
+	return FilterResourceTypes(ListResourceTypes(), include, exclude)
+}
+
+// FilterResourceTypes keeps the resource types that match any of the include
+// patterns, or all of them when there are none, and none of the exclude patterns.
+//
+// A pattern is either a glob on the resource type name, e.g. Github/Artifact/*,
+// or a key=value pair whose value is a glob matched against the tag with that
+// key, e.g. category=artifact_*. Matching is case-insensitive and, like
+// path.Match, '*' does not cross '/'.
+func FilterResourceTypes(resourceTypes []string, include, exclude []string) ([]string, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if err := validatePattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	var result []string
+	for _, name := range resourceTypes {
+		if len(include) > 0 && !matchAny(name, include) {
+			continue
+		}
+		if matchAny(name, exclude) {
+			continue
+		}
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+func validatePattern(pattern string) error {
+	if _, valuePattern, ok := strings.Cut(pattern, "="); ok {
+		pattern = valuePattern
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid resource type pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+func matchAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if MatchResourceType(name, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchResourceType reports whether the resource type matches a single pattern.
+func MatchResourceType(name string, pattern string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "" {
+		return false
+	}
+
+	tagKey, valuePattern, isTag := strings.Cut(pattern, "=")
+	if !isTag {
+		ok, _ := path.Match(pattern, strings.ToLower(name))
+		return ok
+	}
+
+	rt, err := GetResourceType(name)
+	if err != nil {
+		return false
+	}
+	for key, values := range rt.Tags {
+		if strings.ToLower(key) != strings.TrimSpace(tagKey) {
+			continue
+		}
+		for _, value := range values {
+			if ok, _ := path.Match(strings.TrimSpace(valuePattern), strings.ToLower(value)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func GetResources(
 	ctx context.Context,
 	logger *zap.Logger,
@@ -65,10 +148,20 @@ func describe(ctx context.Context, logger *zap.Logger, accountCfg model.Integrat
 		return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
 	}
 	ctx = describers.WithLogger(ctx, logger)
+	ctx = withStats(ctx)
 
 	return resourceTypeObject.ListDescriber(ctx, accountCfg, triggerType, additionalParameters, stream)
 }
 
+// withStats makes sure the describer has a stats collector, a fresh one when
+// the caller did not attach any.
+func withStats(ctx context.Context) context.Context {
+	if describers.GetStatsFromContext(ctx) != nil {
+		return ctx
+	}
+	return describers.WithStats(ctx, model.NewDescribeStats())
+}
+
 func GetSingleResource(
 	ctx context.Context,
 	logger *zap.Logger,
@@ -92,6 +185,7 @@ func describeSingle(ctx context.Context, logger *zap.Logger, accountCfg model.In
 		return nil, fmt.Errorf("unsupported resource type: %s", resourceType)
 	}
 	ctx = describers.WithLogger(ctx, logger)
+	ctx = withStats(ctx)
 
 	return resourceTypeObject.GetDescriber(ctx, accountCfg, triggerType, additionalParameters, resourceID, stream)
 }
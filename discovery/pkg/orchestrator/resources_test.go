@@ -0,0 +1,77 @@
+package orchestrator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchResourceType(t *testing.T) {
+	const dockerfile = "Github/Artifact/DockerFile"
+	tests := []struct {
+		name     string
+		resource string
+		pattern  string
+		want     bool
+	}{
+		{name: "exact name", resource: dockerfile, pattern: "Github/Artifact/DockerFile", want: true},
+		{name: "ignores case", resource: dockerfile, pattern: "github/artifact/dockerfile", want: true},
+		{name: "glob", resource: dockerfile, pattern: "Github/Artifact/*", want: true},
+		{name: "glob does not cross slashes", resource: dockerfile, pattern: "Github/*", want: false},
+		{name: "glob per segment", resource: dockerfile, pattern: "*/*/Docker*", want: true},
+		{name: "other name", resource: dockerfile, pattern: "Github/Repository", want: false},
+		{name: "blank pattern", resource: dockerfile, pattern: " ", want: false},
+		{name: "tag value", resource: dockerfile, pattern: "category=artifact_dockerfile", want: true},
+		{name: "tag glob", resource: dockerfile, pattern: "category=artifact_*", want: true},
+		{name: "tag key ignores case", resource: dockerfile, pattern: "Category=ARTIFACT_*", want: true},
+		{name: "other tag value", resource: dockerfile, pattern: "category=repository", want: false},
+		{name: "unknown tag", resource: dockerfile, pattern: "team=*", want: false},
+		{name: "tag of unknown resource type", resource: "Github/Unknown", pattern: "category=*", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchResourceType(tt.resource, tt.pattern); got != tt.want {
+				t.Errorf("MatchResourceType(%q, %q) = %v, want %v", tt.resource, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterResourceTypes(t *testing.T) {
+	resourceTypes := []string{"Github/Artifact/DockerFile", "Github/Artifact/Package", "Github/Repository"}
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{name: "no patterns", want: resourceTypes},
+		{name: "include glob", include: []string{"Github/Artifact/*"}, want: []string{"Github/Artifact/DockerFile", "Github/Artifact/Package"}},
+		{name: "include any", include: []string{"Github/Repository", "*/*/Package"}, want: []string{"Github/Artifact/Package", "Github/Repository"}},
+		{name: "exclude", exclude: []string{"Github/Artifact/*"}, want: []string{"Github/Repository"}},
+		{name: "include and exclude", include: []string{"Github/Artifact/*"}, exclude: []string{"category=artifact_*"}, want: []string{"Github/Artifact/Package"}},
+		{name: "include tag", include: []string{"category=artifact_dockerfile"}, want: []string{"Github/Artifact/DockerFile"}},
+		{name: "nothing matches", include: []string{"Azure/*"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FilterResourceTypes(resourceTypes, tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterResourceTypes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterResourceTypesInvalidPattern(t *testing.T) {
+	for _, pattern := range []string{"Github/[", "category=[a"} {
+		if _, err := FilterResourceTypes([]string{"Github/Repository"}, []string{pattern}, nil); err == nil {
+			t.Errorf("FilterResourceTypes with include %q succeeded, want an error", pattern)
+		}
+		if _, err := FilterResourceTypes([]string{"Github/Repository"}, nil, []string{pattern}); err == nil {
+			t.Errorf("FilterResourceTypes with exclude %q succeeded, want an error", pattern)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	SinkGRPC   = "grpc"
+	SinkHTTP   = "http"
+	SinkFile   = "file"
+	SinkStdout = "stdout"
+)
+
+// ErrBatchTooLarge is returned by a Sink that refused a batch because of its
+// size. The ResourceSender then splits the batch and lowers its batch size.
+var ErrBatchTooLarge = errors.New("batch too large for the sink")
+
+// Sink delivers serialized documents. Ingest is all or nothing: when it
+// returns an error none of the documents are considered delivered. Ingest is
+// called from several goroutines at once.
+type Sink interface {
+	Ingest(ctx context.Context, docs []SinkDoc) error
+	Close() error
+}
+
+// SinkDoc is a serialized document on its way to the sink. Resource is set for
+// resource documents, as opposed to their lookup documents, so that deliveries
+// can be counted per resource. Delete marks a tombstone: sinks that can delete
+// remove the document, the others store Data, which flags it as deleted.
+type SinkDoc struct {
+	Resource bool            `json:"resource,omitempty"`
+	Delete   bool            `json:"delete,omitempty"`
+	ID       string          `json:"id"`
+	Index    string          `json:"index"`
+	Data     json.RawMessage `json:"doc"`
+}
+
+// NewSink picks the sink of a describe job. The sink param (grpc, http, file
+// or stdout) wins. Otherwise the OpenSearch ingestion pipeline is used when
+// useOpenSearch is set, and the grpc endpoint decides by its scheme:
+// file://<path>, stdout or "-", http(s)://<url>, anything else is the gRPC
+// EsSink service.
+func NewSink(grpcEndpoint, ingestionPipelineEndpoint string, useOpenSearch bool, jobID uint, params map[string]string, connConfig ConnConfig) (Sink, error) {
+	kind := strings.ToLower(strings.TrimSpace(params["sink"]))
+	endpoint := grpcEndpoint
+	pipeline := useOpenSearch && ingestionPipelineEndpoint != ""
+	if kind == "" {
+		switch {
+		case pipeline:
+			kind = SinkHTTP
+		case grpcEndpoint == "-" || grpcEndpoint == SinkStdout:
+			kind = SinkStdout
+		case strings.HasPrefix(grpcEndpoint, "file://"):
+			kind = SinkFile
+		case strings.HasPrefix(grpcEndpoint, "http://"), strings.HasPrefix(grpcEndpoint, "https://"):
+			kind = SinkHTTP
+		default:
+			kind = SinkGRPC
+		}
+	}
+
+	switch kind {
+	case SinkGRPC:
+		return NewGRPCSink(endpoint, jobID, connConfig)
+	case SinkHTTP:
+		if pipeline {
+			return NewIngestionPipelineSink(ingestionPipelineEndpoint, connConfig)
+		}
+		return NewHTTPSink(endpoint, connConfig)
+	case SinkFile:
+		path := strings.TrimSpace(params["sink_file"])
+		if path == "" {
+			u, err := url.Parse(endpoint)
+			if err != nil {
+				return nil, fmt.Errorf("invalid file sink endpoint %s: %w", endpoint, err)
+			}
+			path = u.Host + u.Path
+		}
+		return NewFileSink(path)
+	case SinkStdout:
+		return NewWriterSink(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unknown sink %s", kind)
+	}
+}
@@ -0,0 +1,92 @@
+package orchestrator
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// WriterSink writes every document as a line of NDJSON, for inspecting what
+// would be indexed or feeding it into other tools.
+type WriterSink struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+}
+
+// NewWriterSink writes to w and leaves closing it to the caller.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: bufio.NewWriter(w)}
+}
+
+// NewFileSink creates or truncates the file at path.
+func NewFileSink(path string) (*WriterSink, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create file sink dir: %w", err)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file sink: %w", err)
+	}
+	return &WriterSink{w: bufio.NewWriter(f), closer: f}, nil
+}
+
+func (s *WriterSink) Ingest(_ context.Context, docs []SinkDoc) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, doc := range docs {
+		if _, err := s.w.Write(doc.Data); err != nil {
+			return err
+		}
+		if err := s.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return s.w.Flush()
+}
+
+func (s *WriterSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+// MemorySink keeps the documents in memory, for tests.
+type MemorySink struct {
+	mu   sync.Mutex
+	docs []SinkDoc
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (s *MemorySink) Ingest(_ context.Context, docs []SinkDoc) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs = append(s.docs, docs...)
+	return nil
+}
+
+func (s *MemorySink) Close() error {
+	return nil
+}
+
+// Documents returns a copy of the documents ingested so far.
+func (s *MemorySink) Documents() []SinkDoc {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SinkDoc(nil), s.docs...)
+}
@@ -0,0 +1,110 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/opengovern/og-util/proto/src/golang"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// GRPCSink sends documents to the platform EsSink service.
+type GRPCSink struct {
+	endpoint   string
+	jobID      uint
+	connConfig ConnConfig
+
+	mu     sync.Mutex
+	conn   *grpc.ClientConn
+	client golang.EsSinkServiceClient
+}
+
+func NewGRPCSink(endpoint string, jobID uint, connConfig ConnConfig) (*GRPCSink, error) {
+	s := &GRPCSink{
+		endpoint:   endpoint,
+		jobID:      jobID,
+		connConfig: connConfig,
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// connect dials the sink, it is called with mu held or before first use.
+func (s *GRPCSink) connect() error {
+	opts, err := s.connConfig.DialOptions()
+	if err != nil {
+		return fmt.Errorf("invalid sink connection config: %w", err)
+	}
+
+	conn, err := grpc.NewClient(
+		s.endpoint,
+		opts...,
+	)
+	if err != nil {
+		return err
+	}
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn = conn
+	s.client = golang.NewEsSinkServiceClient(conn)
+	return nil
+}
+
+func (s *GRPCSink) Ingest(ctx context.Context, docs []SinkDoc) error {
+	grpcCtx := metadata.NewOutgoingContext(ctx, metadata.New(map[string]string{
+		"resource-job-id": fmt.Sprintf("%d", s.jobID),
+	}))
+
+	anyDocs := make([]*anypb.Any, 0, len(docs))
+	for _, doc := range docs {
+		anyDocs = append(anyDocs, &anypb.Any{Value: doc.Data})
+	}
+
+	s.mu.Lock()
+	client := s.client
+	s.mu.Unlock()
+
+	_, err := client.Ingest(grpcCtx, &golang.IngestRequest{Docs: anyDocs})
+	if err == nil {
+		return nil
+	}
+	if messageTooLarge(err) {
+		return fmt.Errorf("%w: %v", ErrBatchTooLarge, err)
+	}
+	if errors.Is(err, io.EOF) {
+		s.mu.Lock()
+		// Another ingest call may have reconnected already.
+		if s.client == client {
+			if connErr := s.connect(); connErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to reconnect: %w", connErr))
+			}
+		}
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// messageTooLarge reports whether err is gRPC refusing a message over its size
+// limit. ResourceExhausted is also used for quotas and throttling, those stay
+// retryable errors and the batch is spooled.
+func messageTooLarge(err error) bool {
+	s, ok := status.FromError(err)
+	return ok && s.Code() == codes.ResourceExhausted && strings.Contains(s.Message(), "larger than max")
+}
+
+func (s *GRPCSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.Close()
+}
@@ -0,0 +1,30 @@
+package orchestrator
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMessageTooLarge(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "received over the limit", err: status.Error(codes.ResourceExhausted, "grpc: received message larger than max (5000000 vs. 4194304)"), want: true},
+		{name: "sending over the limit", err: status.Error(codes.ResourceExhausted, "grpc: trying to send message larger than max (5000000 vs. 4194304)"), want: true},
+		{name: "quota", err: status.Error(codes.ResourceExhausted, "quota exceeded, retry later"), want: false},
+		{name: "other code", err: status.Error(codes.Unavailable, "message larger than max"), want: false},
+		{name: "not a status", err: errors.New("larger than max"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := messageTooLarge(tt.err); got != tt.want {
+				t.Errorf("messageTooLarge(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
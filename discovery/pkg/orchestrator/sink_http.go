@@ -0,0 +1,226 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/opengovern/og-describer-template/discovery/pkg/retry"
+	"golang.org/x/oauth2"
+)
+
+const HTTPSinkTimeout = 30 * time.Second
+
+// HTTPSink writes documents through the Elasticsearch/OpenSearch bulk API of a
+// plain cluster, or as the JSON array of documents taken by the HTTP source of
+// an OpenSearch ingestion pipeline. A bulk endpoint without a path gets /_bulk
+// appended.
+type HTTPSink struct {
+	endpoint    string
+	pipeline    bool
+	httpClient  *http.Client
+	tokenSource oauth2.TokenSource
+}
+
+func NewHTTPSink(endpoint string, connConfig ConnConfig) (*HTTPSink, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http sink endpoint %s: %w", endpoint, err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/_bulk"
+	}
+	return newHTTPSink(u.String(), false, connConfig)
+}
+
+// NewIngestionPipelineSink returns an HTTPSink posting to the HTTP source of an
+// OpenSearch ingestion pipeline. Every document carries its id and index in the
+// es_id and es_index fields, for the pipeline to route it. The pipeline cannot
+// delete, tombstones are indexed with their deleted flag.
+func NewIngestionPipelineSink(endpoint string, connConfig ConnConfig) (*HTTPSink, error) {
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid ingestion pipeline endpoint %s: %w", endpoint, err)
+	}
+	return newHTTPSink(endpoint, true, connConfig)
+}
+
+func newHTTPSink(endpoint string, pipeline bool, connConfig ConnConfig) (*HTTPSink, error) {
+	tlsConfig, err := connConfig.TLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid sink connection config: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &HTTPSink{
+		endpoint:    endpoint,
+		pipeline:    pipeline,
+		httpClient:  &http.Client{Timeout: HTTPSinkTimeout, Transport: transport},
+		tokenSource: connConfig.TokenSource,
+	}, nil
+}
+
+type bulkAction struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  any `json:"error"`
+	} `json:"items"`
+}
+
+func (s *HTTPSink) Ingest(ctx context.Context, docs []SinkDoc) error {
+	var body []byte
+	var err error
+	contentType := "application/x-ndjson"
+	if s.pipeline {
+		body, err = pipelineBody(docs)
+		contentType = "application/json"
+	} else {
+		body, err = bulkBody(docs)
+	}
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.tokenSource != nil {
+		token, err := s.tokenSource.Token()
+		if err != nil {
+			return fmt.Errorf("failed to get sink token: %w", err)
+		}
+		token.SetAuthHeader(req)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusRequestEntityTooLarge:
+		return fmt.Errorf("%w: %s", ErrBatchTooLarge, resp.Status)
+	case resp.StatusCode >= 300:
+		// Only the start of an error body is kept for the message.
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		err := fmt.Errorf("bulk request failed with %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+		if retryableStatus(resp.StatusCode) {
+			return retry.Retryable(err)
+		}
+		return err
+	}
+
+	// Ingestion pipelines accept the batch as a whole, clusters list the result
+	// of every item. A bulk response that cannot be read is not a delivery.
+	if s.pipeline {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	var bulkResp bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&bulkResp); err != nil {
+		return retry.Retryable(fmt.Errorf("failed to read bulk response: %w", err))
+	}
+	if !bulkResp.Errors {
+		return nil
+	}
+	failed := 0
+	retryable := false
+	var firstErr any
+	for _, item := range bulkResp.Items {
+		for _, result := range item {
+			// Deleting a document that is already gone is fine.
+			if result.Status >= 300 && result.Status != http.StatusNotFound {
+				failed++
+				retryable = retryable || retryableStatus(result.Status)
+				if firstErr == nil {
+					firstErr = result.Error
+				}
+			}
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	err = fmt.Errorf("bulk request failed for %d of %d documents: %v", failed, len(docs), firstErr)
+	if retryable {
+		// Documents are indexed by ID, sending the whole batch again is safe.
+		return retry.Retryable(err)
+	}
+	return err
+}
+
+// retryableStatus reports whether a response status is worth retrying:
+// throttling and server errors.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// bulkBody renders docs as a _bulk NDJSON body.
+func bulkBody(docs []SinkDoc) ([]byte, error) {
+	var body bytes.Buffer
+	for _, doc := range docs {
+		op := "index"
+		if doc.Delete {
+			op = "delete"
+		}
+		action, err := json.Marshal(map[string]bulkAction{
+			op: {Index: doc.Index, ID: doc.ID},
+		})
+		if err != nil {
+			return nil, err
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+		if !doc.Delete {
+			body.Write(doc.Data)
+			body.WriteByte('\n')
+		}
+	}
+	return body.Bytes(), nil
+}
+
+// pipelineBody renders docs as the JSON array of an ingestion pipeline, the
+// id and index of every document added as es_id and es_index.
+func pipelineBody(docs []SinkDoc) ([]byte, error) {
+	items := make([]map[string]json.RawMessage, 0, len(docs))
+	for _, doc := range docs {
+		item := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(doc.Data, &item); err != nil {
+			return nil, fmt.Errorf("failed to decode document %s: %w", doc.ID, err)
+		}
+		id, err := json.Marshal(doc.ID)
+		if err != nil {
+			return nil, err
+		}
+		index, err := json.Marshal(doc.Index)
+		if err != nil {
+			return nil, err
+		}
+		item["es_id"] = id
+		item["es_index"] = index
+		items = append(items, item)
+	}
+	return json.Marshal(items)
+}
+
+func (s *HTTPSink) Close() error {
+	s.httpClient.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,439 @@
+package orchestrator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SpoolDirEnv              = "DESCRIBER_SPOOL_DIR"
+	DefaultSpoolSegmentSize  = 16 * 1024 * 1024
+	DefaultSpoolMaxBytes     = 256 * 1024 * 1024
+	DefaultSpoolDrainTimeout = 2 * time.Minute
+	spoolReplayBatchSize     = 2 * MaxBufferSize
+	spoolMaxLineSize         = 64 * 1024 * 1024
+
+	// A spool whose heartbeat is older than spoolStaleAfter was left behind
+	// by a crashed process and is adopted by the next sender. One that nobody
+	// adopted within spoolOrphanAge, because it was too large, is removed.
+	spoolStaleAfter     = 10 * time.Minute
+	spoolOrphanAge      = 24 * time.Hour
+	spoolHeartbeatFile  = "heartbeat"
+	spoolOrphanDirFmt   = "orphan-%d"
+	spoolSegmentPattern = "*.jsonl"
+)
+
+// errSpoolFull is returned by Append once the spool holds maxBytes.
+var errSpoolFull = errors.New("spool is full")
+
+// spool keeps the documents the sink did not accept in segmented JSONL files,
+// one SinkDoc per line, so they can be replayed once the sink recovers.
+// Whatever is still pending when the sender finishes is counted as failed and
+// removed.
+//
+// A live spool touches its heartbeat file. The spool of a crashed process
+// stops doing so and is adopted by the next sender started on the same spool
+// dir, which replays it before its own documents. Documents delivered right
+// before a crash may be sent again, which is harmless as the sink indexes them
+// by ID.
+//
+// The disk usage of a spool, adopted documents included, is bounded by the
+// sink_spool_max_bytes param, DefaultSpoolMaxBytes by default. It is only used
+// from the ResourceHandler goroutine and needs no locking.
+type spool struct {
+	root           string
+	dir            string
+	maxSegmentSize int64
+	maxBytes       int64
+
+	segments []*spoolSegment
+	current  *os.File
+	next     int
+
+	// orphans maps the adopted spool directories, moved under dir, to their
+	// name under root.
+	orphans map[string]string
+}
+
+type spoolSegment struct {
+	path string
+	size int64
+	docs int
+	// sent is the number of leading documents already delivered.
+	sent int
+	// orphan is set on the segments of an adopted spool.
+	orphan bool
+}
+
+// spoolRoot returns the sink_spool_dir param, else the DESCRIBER_SPOOL_DIR
+// env, else a directory in the temp dir.
+func spoolRoot(params map[string]string) string {
+	root := strings.TrimSpace(params["sink_spool_dir"])
+	if root == "" {
+		root = os.Getenv(SpoolDirEnv)
+	}
+	if root == "" {
+		root = filepath.Join(os.TempDir(), "og-describer-spool")
+	}
+	return root
+}
+
+// newSpool creates a spool directory for a single resource sender under
+// spoolRoot. Spools of crashed processes older than spoolOrphanAge found
+// there are removed.
+func newSpool(jobID uint, params map[string]string) (*spool, error) {
+	root := spoolRoot(params)
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir: %w", err)
+	}
+	removeOrphanSpools(root, time.Now().Add(-spoolOrphanAge))
+	dir, err := os.MkdirTemp(root, fmt.Sprintf("job-%d-", jobID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool dir: %w", err)
+	}
+	heartbeat, err := os.OpenFile(filepath.Join(dir, spoolHeartbeatFile), os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create spool heartbeat: %w", err)
+	}
+	heartbeat.Close()
+
+	maxBytes := int64(DefaultSpoolMaxBytes)
+	if n, err := strconv.ParseInt(strings.TrimSpace(params["sink_spool_max_bytes"]), 10, 64); err == nil && n > 0 {
+		maxBytes = n
+	}
+	return &spool{
+		root:           root,
+		dir:            dir,
+		maxSegmentSize: DefaultSpoolSegmentSize,
+		maxBytes:       maxBytes,
+		orphans:        make(map[string]string),
+	}, nil
+}
+
+// spoolLastUsed returns when the spool in dir was last touched, falling back
+// to the modification time of the directory when it has no heartbeat.
+func spoolLastUsed(dir string) (time.Time, error) {
+	info, err := os.Stat(filepath.Join(dir, spoolHeartbeatFile))
+	if os.IsNotExist(err) {
+		info, err = os.Stat(dir)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// staleSpools returns the job-* spool directories under root last used
+// before cutoff.
+func staleSpools(root string, cutoff time.Time) []string {
+	dirs, err := filepath.Glob(filepath.Join(root, "job-*"))
+	if err != nil {
+		return nil
+	}
+	var stale []string
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		if used, err := spoolLastUsed(dir); err == nil && used.Before(cutoff) {
+			stale = append(stale, dir)
+		}
+	}
+	return stale
+}
+
+// removeOrphanSpools removes the job-* spool directories under root that were
+// last used before cutoff. Failures are ignored, the next spool tries again.
+func removeOrphanSpools(root string, cutoff time.Time) {
+	for _, dir := range staleSpools(root, cutoff) {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// Touch refreshes the heartbeat, so the spool is not adopted by another
+// sender. A failure only risks that, it is ignored.
+func (s *spool) Touch() {
+	now := time.Now()
+	_ = os.Chtimes(filepath.Join(s.dir, spoolHeartbeatFile), now, now)
+}
+
+// Adopt moves the given spool directories of crashed senders into this spool,
+// their documents are replayed before the ones appended later. It must be
+// called before the first Append. A directory that would grow the spool past
+// maxBytes, or that another sender claimed first, is skipped. It returns the
+// number of adopted documents.
+func (s *spool) Adopt(dirs []string) (int, error) {
+	adopted := 0
+	var errs []error
+	for _, dir := range dirs {
+		if dir == s.dir {
+			continue
+		}
+		segments, err := readSpoolSegments(dir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var size int64
+		for _, seg := range segments {
+			size += seg.size
+		}
+		if s.maxBytes > 0 && s.Size()+size > s.maxBytes {
+			errs = append(errs, fmt.Errorf("%w: spool %s has %d bytes", errSpoolFull, dir, size))
+			continue
+		}
+
+		// The rename claims the directory, when another sender adopts it at
+		// the same time only one of them succeeds.
+		claimed := filepath.Join(s.dir, fmt.Sprintf(spoolOrphanDirFmt, len(s.orphans)))
+		if err := os.Rename(dir, claimed); err != nil {
+			continue
+		}
+		s.orphans[claimed] = filepath.Base(dir)
+		for _, seg := range segments {
+			seg.path = filepath.Join(claimed, filepath.Base(seg.path))
+			seg.orphan = true
+			adopted += seg.docs
+		}
+		s.segments = append(s.segments, segments...)
+	}
+	return adopted, errors.Join(errs...)
+}
+
+// readSpoolSegments lists the segments of the spool in dir. A line cut short
+// by a crash is not counted, so it is never replayed.
+func readSpoolSegments(dir string) ([]*spoolSegment, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, spoolSegmentPattern))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	segments := make([]*spoolSegment, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spool segment %s: %w", path, err)
+		}
+		docs := bytes.Count(data, []byte{'\n'})
+		if docs == 0 {
+			continue
+		}
+		segments = append(segments, &spoolSegment{
+			path: path,
+			size: int64(len(data)),
+			docs: docs,
+		})
+	}
+	return segments, nil
+}
+
+// Size returns the bytes of the segments on disk.
+func (s *spool) Size() int64 {
+	var size int64
+	for _, seg := range s.segments {
+		size += seg.size
+	}
+	return size
+}
+
+// Pending returns the number of spooled documents not delivered yet.
+func (s *spool) Pending() int {
+	n := 0
+	for _, seg := range s.segments {
+		n += seg.docs - seg.sent
+	}
+	return n
+}
+
+// PendingOrphans returns the number of adopted documents not delivered yet.
+func (s *spool) PendingOrphans() int {
+	n := 0
+	for _, seg := range s.segments {
+		if seg.orphan {
+			n += seg.docs - seg.sent
+		}
+	}
+	return n
+}
+
+// Append writes docs to the current segment, starting a new one when it
+// grew past maxSegmentSize. It returns errSpoolFull, writing nothing, when the
+// docs would grow the spool past maxBytes.
+func (s *spool) Append(docs []SinkDoc) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	lines := make([][]byte, 0, len(docs))
+	size := s.Size()
+	for _, doc := range docs {
+		line, err := json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("failed to encode spooled document: %w", err)
+		}
+		size += int64(len(line)) + 1
+		lines = append(lines, line)
+	}
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return fmt.Errorf("%w: %d documents would exceed %d bytes", errSpoolFull, len(docs), s.maxBytes)
+	}
+	if s.current == nil || s.segments[len(s.segments)-1].orphan || s.segments[len(s.segments)-1].size >= s.maxSegmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	seg := s.segments[len(s.segments)-1]
+	w := bufio.NewWriter(s.current)
+	for _, line := range lines {
+		n, err := w.Write(line)
+		if err == nil {
+			err = w.WriteByte('\n')
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write spool segment %s: %w", seg.path, err)
+		}
+		seg.size += int64(n) + 1
+		seg.docs++
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write spool segment %s: %w", seg.path, err)
+	}
+	return s.current.Sync()
+}
+
+func (s *spool) rotate() error {
+	if err := s.closeCurrent(); err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, fmt.Sprintf("%06d.jsonl", s.next))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create spool segment: %w", err)
+	}
+	s.next++
+	s.current = f
+	s.segments = append(s.segments, &spoolSegment{path: path})
+	return nil
+}
+
+func (s *spool) closeCurrent() error {
+	if s.current == nil {
+		return nil
+	}
+	err := s.current.Close()
+	s.current = nil
+	return err
+}
+
+// Replay sends the oldest segment through send in batches of at most
+// maxBatchBytes, removing it once every document is delivered. It stops at the
+// first failed batch and keeps track of what was already delivered, so
+// nothing is sent twice. send is told whether the batch comes from an
+// adopted spool.
+func (s *spool) Replay(send func(docs []SinkDoc, orphan bool) (int, error), maxBatchBytes int) error {
+	if len(s.segments) == 0 {
+		return nil
+	}
+	seg := s.segments[0]
+	if len(s.segments) == 1 {
+		// Close the segment being written to, new documents go to a fresh one.
+		if err := s.closeCurrent(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return fmt.Errorf("failed to open spool segment %s: %w", seg.path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), spoolMaxLineSize)
+	line := 0
+	batch := make([]SinkDoc, 0, spoolReplayBatchSize)
+	batchBytes := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		n, err := send(batch, seg.orphan)
+		seg.sent += n
+		if err != nil {
+			return err
+		}
+		batch = batch[:0]
+		batchBytes = 0
+		return nil
+	}
+	for line < seg.docs && scanner.Scan() {
+		line++
+		if line <= seg.sent {
+			continue
+		}
+		var doc SinkDoc
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			return fmt.Errorf("failed to decode spool segment %s line %d: %w", seg.path, line, err)
+		}
+		if len(batch) > 0 && batchBytes+len(doc.Data) > maxBatchBytes {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		batch = append(batch, doc)
+		batchBytes += len(doc.Data)
+		if len(batch) >= spoolReplayBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read spool segment %s: %w", seg.path, err)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	s.segments = s.segments[1:]
+	return os.Remove(seg.path)
+}
+
+// Close closes the open segment and removes the spool directory, together
+// with the documents that were not delivered. Adopted spools with documents
+// left are moved back under root for the next sender.
+func (s *spool) Close() error {
+	err := s.closeCurrent()
+	for dir, name := range s.orphans {
+		if !s.hasSegmentsIn(dir) {
+			continue
+		}
+		if mvErr := os.Rename(dir, filepath.Join(s.root, name)); mvErr != nil && err == nil {
+			err = mvErr
+		}
+	}
+	s.segments = nil
+	if rmErr := os.RemoveAll(s.dir); rmErr != nil && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+func (s *spool) hasSegmentsIn(dir string) bool {
+	for _, seg := range s.segments {
+		if filepath.Dir(seg.path) == dir {
+			return true
+		}
+	}
+	return false
+}
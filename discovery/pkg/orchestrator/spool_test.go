@@ -0,0 +1,347 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testDocs(from, n int) []SinkDoc {
+	docs := make([]SinkDoc, 0, n)
+	for i := from; i < from+n; i++ {
+		docs = append(docs, SinkDoc{
+			Resource: true,
+			ID:       fmt.Sprintf("doc-%d", i),
+			Index:    "index",
+			Data:     json.RawMessage(fmt.Sprintf(`{"n":%d}`, i)),
+		})
+	}
+	return docs
+}
+
+func newTestSpool(t *testing.T, params map[string]string) *spool {
+	t.Helper()
+	if params == nil {
+		params = map[string]string{}
+	}
+	if params["sink_spool_dir"] == "" {
+		params["sink_spool_dir"] = t.TempDir()
+	}
+	s, err := newSpool(1, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+// recorder is a send func of spool.Replay accepting up to accept documents.
+type recorder struct {
+	accept int
+	sent   []string
+}
+
+func (r *recorder) send(docs []SinkDoc, orphan bool) (int, error) {
+	n := len(docs)
+	var err error
+	if r.accept >= 0 && n > r.accept {
+		n, err = r.accept, errors.New("sink unavailable")
+	}
+	for _, doc := range docs[:n] {
+		r.sent = append(r.sent, doc.ID)
+	}
+	if r.accept >= 0 {
+		r.accept -= n
+	}
+	return n, err
+}
+
+func docIDs(docs []SinkDoc) []string {
+	ids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		ids = append(ids, doc.ID)
+	}
+	return ids
+}
+
+func TestSpoolAppendReplay(t *testing.T) {
+	s := newTestSpool(t, nil)
+	if err := s.Append(testDocs(0, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(testDocs(3, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Pending(); got != 5 {
+		t.Fatalf("Pending() = %d, want 5", got)
+	}
+
+	r := &recorder{accept: -1}
+	if err := s.Replay(r.send, DefaultMaxBatchBytes); err != nil {
+		t.Fatal(err)
+	}
+	if want := docIDs(testDocs(0, 5)); !reflect.DeepEqual(r.sent, want) {
+		t.Errorf("sent %v, want %v", r.sent, want)
+	}
+	if got := s.Pending(); got != 0 {
+		t.Errorf("Pending() = %d after replay, want 0", got)
+	}
+	segments, _ := filepath.Glob(filepath.Join(s.dir, "*.jsonl"))
+	if len(segments) != 0 {
+		t.Errorf("segments left after replay: %v", segments)
+	}
+}
+
+func TestSpoolPartialSend(t *testing.T) {
+	s := newTestSpool(t, nil)
+	if err := s.Append(testDocs(0, 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &recorder{accept: 2}
+	if err := s.Replay(r.send, DefaultMaxBatchBytes); err == nil {
+		t.Fatal("Replay() succeeded, want the send error")
+	}
+	if got := s.Pending(); got != 3 {
+		t.Fatalf("Pending() = %d after partial send, want 3", got)
+	}
+
+	// Documents appended meanwhile go after the ones already spooled, and
+	// nothing delivered before is sent twice.
+	if err := s.Append(testDocs(5, 1)); err != nil {
+		t.Fatal(err)
+	}
+	r.accept = -1
+	for s.Pending() > 0 {
+		if err := s.Replay(r.send, DefaultMaxBatchBytes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := docIDs(testDocs(0, 6)); !reflect.DeepEqual(r.sent, want) {
+		t.Errorf("sent %v, want %v", r.sent, want)
+	}
+}
+
+func TestSpoolReplayBatchBytes(t *testing.T) {
+	s := newTestSpool(t, nil)
+	docs := testDocs(0, 4)
+	if err := s.Append(docs); err != nil {
+		t.Fatal(err)
+	}
+
+	var batches [][]string
+	send := func(batch []SinkDoc, orphan bool) (int, error) {
+		batches = append(batches, docIDs(batch))
+		return len(batch), nil
+	}
+	if err := s.Replay(send, 2*len(docs[0].Data)); err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 2 {
+		t.Errorf("batches = %v, want two batches of two documents", batches)
+	}
+}
+
+func TestSpoolRotatesSegments(t *testing.T) {
+	s := newTestSpool(t, nil)
+	s.maxSegmentSize = 1
+	for i := 0; i < 3; i++ {
+		if err := s.Append(testDocs(i, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.segments) != 3 {
+		t.Fatalf("%d segments, want 3", len(s.segments))
+	}
+
+	r := &recorder{accept: -1}
+	if err := s.Replay(r.send, DefaultMaxBatchBytes); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.segments) != 2 || s.Pending() != 2 {
+		t.Errorf("replay sent more than the oldest segment: %d segments, %d pending", len(s.segments), s.Pending())
+	}
+}
+
+func TestSpoolMaxBytes(t *testing.T) {
+	s := newTestSpool(t, map[string]string{"sink_spool_max_bytes": "200"})
+	if err := s.Append(testDocs(0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	size := s.Size()
+	err := s.Append(testDocs(1, 10))
+	if !errors.Is(err, errSpoolFull) {
+		t.Fatalf("Append() error = %v, want errSpoolFull", err)
+	}
+	if s.Size() != size || s.Pending() != 1 {
+		t.Errorf("rejected Append wrote to the spool: size %d, pending %d", s.Size(), s.Pending())
+	}
+}
+
+func TestSpoolCloseRemovesDir(t *testing.T) {
+	s := newTestSpool(t, nil)
+	if err := s.Append(testDocs(0, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.dir); !os.IsNotExist(err) {
+		t.Errorf("spool dir still there after Close: %v", err)
+	}
+}
+
+func TestNewSpoolRemovesOrphans(t *testing.T) {
+	root := t.TempDir()
+	orphan := filepath.Join(root, "job-7-orphan")
+	recent := filepath.Join(root, "job-8-recent")
+	for _, dir := range []string{orphan, recent} {
+		if err := os.Mkdir(dir, 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * spoolOrphanAge)
+	if err := os.Chtimes(orphan, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	newTestSpool(t, map[string]string{"sink_spool_dir": root})
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("orphan spool dir not removed: %v", err)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("recent spool dir removed: %v", err)
+	}
+}
+
+// crash leaves the spool of s behind as a crashed process would, with a
+// heartbeat older than spoolStaleAfter.
+func crash(t *testing.T, s *spool) {
+	t.Helper()
+	if err := s.closeCurrent(); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * spoolStaleAfter)
+	if err := os.Chtimes(filepath.Join(s.dir, spoolHeartbeatFile), old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpoolAdoptsOrphans(t *testing.T) {
+	root := t.TempDir()
+	params := map[string]string{"sink_spool_dir": root}
+	crashed, err := newSpool(1, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crashed.Append(testDocs(0, 3)); err != nil {
+		t.Fatal(err)
+	}
+	// A line cut short by the crash is not replayed.
+	f, err := os.OpenFile(crashed.segments[0].path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"id":"doc-`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	crash(t, crashed)
+
+	live, err := newSpool(2, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+
+	orphans := staleSpools(root, time.Now().Add(-spoolStaleAfter))
+	if !reflect.DeepEqual(orphans, []string{crashed.dir}) {
+		t.Fatalf("staleSpools() = %v, want only %s", orphans, crashed.dir)
+	}
+	s := newTestSpool(t, map[string]string{"sink_spool_dir": root})
+	n, err := s.Adopt(orphans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || s.PendingOrphans() != 3 {
+		t.Fatalf("adopted %d documents, %d pending, want 3", n, s.PendingOrphans())
+	}
+	if _, err := os.Stat(crashed.dir); !os.IsNotExist(err) {
+		t.Errorf("adopted spool still under root: %v", err)
+	}
+
+	// Adopted documents go first and are flagged as such.
+	if err := s.Append(testDocs(3, 1)); err != nil {
+		t.Fatal(err)
+	}
+	var orphanIDs, ownIDs []string
+	send := func(docs []SinkDoc, orphan bool) (int, error) {
+		if orphan {
+			orphanIDs = append(orphanIDs, docIDs(docs)...)
+		} else {
+			ownIDs = append(ownIDs, docIDs(docs)...)
+		}
+		return len(docs), nil
+	}
+	for s.Pending() > 0 {
+		if err := s.Replay(send, DefaultMaxBatchBytes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := docIDs(testDocs(0, 3)); !reflect.DeepEqual(orphanIDs, want) {
+		t.Errorf("replayed orphans %v, want %v", orphanIDs, want)
+	}
+	if want := docIDs(testDocs(3, 1)); !reflect.DeepEqual(ownIDs, want) {
+		t.Errorf("replayed own documents %v, want %v", ownIDs, want)
+	}
+}
+
+func TestSpoolAdoptRespectsMaxBytes(t *testing.T) {
+	root := t.TempDir()
+	crashed, err := newSpool(1, map[string]string{"sink_spool_dir": root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crashed.Append(testDocs(0, 10)); err != nil {
+		t.Fatal(err)
+	}
+	crash(t, crashed)
+
+	s := newTestSpool(t, map[string]string{"sink_spool_dir": root, "sink_spool_max_bytes": "100"})
+	n, err := s.Adopt([]string{crashed.dir})
+	if !errors.Is(err, errSpoolFull) || n != 0 {
+		t.Fatalf("Adopt() = %d, %v, want 0 and errSpoolFull", n, err)
+	}
+	if _, err := os.Stat(crashed.dir); err != nil {
+		t.Errorf("spool too large to adopt was moved: %v", err)
+	}
+}
+
+func TestSpoolCloseReturnsPendingOrphans(t *testing.T) {
+	root := t.TempDir()
+	crashed, err := newSpool(1, map[string]string{"sink_spool_dir": root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crashed.Append(testDocs(0, 2)); err != nil {
+		t.Fatal(err)
+	}
+	crash(t, crashed)
+
+	s := newTestSpool(t, map[string]string{"sink_spool_dir": root})
+	if _, err := s.Adopt([]string{crashed.dir}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	segments, _ := filepath.Glob(filepath.Join(crashed.dir, spoolSegmentPattern))
+	if len(segments) != 1 {
+		t.Errorf("undelivered orphan not returned under root, segments %v", segments)
+	}
+}
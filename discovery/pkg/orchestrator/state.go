@@ -0,0 +1,155 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/opengovern/og-describer-template/global/constants"
+	"github.com/opengovern/og-util/pkg/es"
+	"github.com/opengovern/og-util/pkg/integration"
+	"github.com/opengovern/og-util/pkg/opengovernance-es-sdk"
+)
+
+// ContentHashKey is the resource metadata key holding the content hash.
+const ContentHashKey = "content_hash"
+
+// ResourceState is what change detection remembers of a described resource:
+// the hash of its content and the documents it was indexed as.
+type ResourceState struct {
+	PlatformID string   `json:"platform_id"`
+	ResourceID string   `json:"resource_id"`
+	Hash       string   `json:"hash"`
+	Docs       []DocRef `json:"docs"`
+}
+
+type DocRef struct {
+	ID    string `json:"id"`
+	Index string `json:"index"`
+}
+
+// ResourceStateStore keeps the resource states of the previous describe of an
+// (integration, resource type) pair, keyed by PlatformID.
+type ResourceStateStore interface {
+	Load(ctx context.Context, integrationID, resourceType string) (map[string]ResourceState, error)
+	Save(ctx context.Context, integrationID, resourceType string, states map[string]ResourceState) error
+}
+
+// contentHash hashes the description JSON and the key of the pipeline
+// normalising it, together with the fields that end up next to it in the
+// resource document.
+func contentHash(descriptionJSON []byte, normalizerKey, name string, tags []es.Tag) string {
+	h := sha256.New()
+	h.Write(descriptionJSON)
+	h.Write([]byte{0})
+	h.Write([]byte(normalizerKey))
+	h.Write([]byte{0})
+	h.Write([]byte(name))
+	tags = append([]es.Tag(nil), tags...)
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Key != tags[j].Key {
+			return tags[i].Key < tags[j].Key
+		}
+		return tags[i].Value < tags[j].Value
+	})
+	for _, tag := range tags {
+		h.Write([]byte{0})
+		h.Write([]byte(tag.Key + "=" + tag.Value))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// resourceState returns the state of a resource built for sending.
+func resourceState(resource *es.Resource, params map[string]string, hash string) ResourceState {
+	state := ResourceState{
+		PlatformID: resource.PlatformID,
+		ResourceID: resource.ResourceID,
+		Hash:       hash,
+	}
+	for _, doc := range resourceDocs(resource, params) {
+		keys, idx := doc.KeysAndIndex()
+		state.Docs = append(state.Docs, DocRef{ID: es.HashOf(keys...), Index: idx})
+	}
+	return state
+}
+
+// tombstone marks a document of a resource that disappeared at the provider.
+type tombstone struct {
+	EsID            string           `json:"es_id"`
+	EsIndex         string           `json:"es_index"`
+	PlatformID      string           `json:"platform_id"`
+	ResourceID      string           `json:"resource_id"`
+	ResourceType    string           `json:"resource_type"`
+	IntegrationType integration.Type `json:"integration_type"`
+	IntegrationID   string           `json:"integration_id"`
+	DescribedBy     string           `json:"described_by"`
+	DescribedAt     int64            `json:"described_at"`
+	Deleted         bool             `json:"deleted"`
+}
+
+// tombstoneDocs returns the delete documents of every document of state.
+func tombstoneDocs(state ResourceState, integrationID, resourceType, describedBy string, describedAt int64) ([]SinkDoc, error) {
+	docs := make([]SinkDoc, 0, len(state.Docs))
+	for _, ref := range state.Docs {
+		data, err := json.Marshal(tombstone{
+			EsID:            ref.ID,
+			EsIndex:         ref.Index,
+			PlatformID:      state.PlatformID,
+			ResourceID:      state.ResourceID,
+			ResourceType:    strings.ToLower(resourceType),
+			IntegrationType: constants.IntegrationName,
+			IntegrationID:   integrationID,
+			DescribedBy:     describedBy,
+			DescribedAt:     describedAt,
+			Deleted:         true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, SinkDoc{ID: ref.ID, Index: ref.Index, Delete: true, Data: data})
+	}
+	return docs, nil
+}
+
+// ESResourceStateStore reads the states from the documents indexed by the
+// previous describe, the content hash being kept in their metadata. Save is a
+// no-op since the sink writes the documents.
+type ESResourceStateStore struct {
+	client opengovernance.Client
+}
+
+func NewESResourceStateStore(client opengovernance.Client) *ESResourceStateStore {
+	return &ESResourceStateStore{client: client}
+}
+
+func (s *ESResourceStateStore) Load(ctx context.Context, integrationID, resourceType string) (map[string]ResourceState, error) {
+	return IndexedResources(ctx, s.client, integrationID, resourceType)
+}
+
+func (s *ESResourceStateStore) Save(context.Context, string, string, map[string]ResourceState) error {
+	return nil
+}
+
+// ResourceStateStoreFromParams returns the store of the describe workers,
+// selected by the change_detection param. Only "es" is supported: the states
+// are read from the index itself, a state kept by the worker could match the
+// current content while the index holds another version, written by another
+// worker or lost in a rebuild, and the resource would then never be sent
+// again. Without the param change detection is off and nil is returned.
+func ResourceStateStoreFromParams(params map[string]string, esClient opengovernance.Client) (ResourceStateStore, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(params["change_detection"])); mode {
+	case "", "off", "false":
+		return nil, nil
+	case "es":
+		if esClient == nil {
+			return nil, fmt.Errorf("change detection from es needs an es client")
+		}
+		return NewESResourceStateStore(esClient), nil
+	default:
+		return nil, fmt.Errorf("unknown change_detection mode %s", mode)
+	}
+}
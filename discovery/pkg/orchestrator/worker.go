@@ -2,17 +2,15 @@ package orchestrator
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/opengovern/og-describer-template/discovery/describers"
 	model "github.com/opengovern/og-describer-template/discovery/pkg/models"
 	"github.com/opengovern/og-describer-template/discovery/provider"
-	"github.com/opengovern/og-describer-template/global"
-	"github.com/opengovern/og-describer-template/global/constants"
 	describe2 "github.com/opengovern/og-util/pkg/describe"
-	"github.com/opengovern/og-util/pkg/es"
+	"github.com/opengovern/og-util/pkg/opengovernance-es-sdk"
 	"go.uber.org/zap"
-	strconv "strconv"
-	"strings"
+	"sync"
 )
 
 type Error struct {
@@ -21,30 +19,53 @@ type Error struct {
 	error
 }
 
-func trimEmptyMaps(input map[string]any) {
-	for key, value := range input {
-		switch value.(type) {
-		case map[string]any:
-			if len(value.(map[string]any)) != 0 {
-				trimEmptyMaps(value.(map[string]any))
-			}
-			if len(value.(map[string]any)) == 0 {
-				delete(input, key)
-			}
-		}
+// DescribeOption changes how Describe sends the described resources.
+type DescribeOption func(*describeOptions)
+
+type describeOptions struct {
+	stateStore    ResourceStateStore
+	indexedClient opengovernance.Client
+	deletions     bool
+	deletionGuard DeletionGuard
+}
+
+func (o describeOptions) detectDeletions() bool {
+	return o.deletions
+}
+
+// ErrNoKnownResources is returned when deletion detection is requested without
+// a state store or indexed resources to compare the describe to.
+var ErrNoKnownResources = errors.New("deletion detection needs a resource state store or indexed resources")
+
+// WithResourceStateStore turns on change detection: only new or changed
+// resources are sent. With WithDeletionDetection, tombstones are sent for the
+// ones that disappeared since the previous describe stored in store.
+func WithResourceStateStore(store ResourceStateStore) DescribeOption {
+	return func(o *describeOptions) {
+		o.stateStore = store
 	}
 }
 
-func trimJsonFromEmptyObjects(input []byte) ([]byte, error) {
-	unknownData := map[string]any{}
-	err := json.Unmarshal(input, &unknownData)
-	if err != nil {
-		return nil, err
+// WithIndexedResources makes the resources indexed in es the known resources
+// of WithDeletionDetection, instead of the states of the previous describe.
+func WithIndexedResources(client opengovernance.Client) DescribeOption {
+	return func(o *describeOptions) {
+		o.indexedClient = client
 	}
-	trimEmptyMaps(unknownData)
-	return json.Marshal(unknownData)
 }
 
+// WithDeletionDetection sends tombstones for the known resources the describe
+// did not produce, see sendDeletions. It needs a state store or indexed
+// resources, else the describe fails with ErrNoKnownResources, and is off by
+// default, as it deletes documents.
+func WithDeletionDetection() DescribeOption {
+	return func(o *describeOptions) {
+		o.deletions = true
+	}
+}
+
+// Describe describes job and sends the resources to the sink selected by the
+// endpoints and params, see NewSink and DescribeToSink.
 func Describe(
 	ctx context.Context,
 	logger *zap.Logger,
@@ -53,109 +74,214 @@ func Describe(
 	config map[string]any,
 	grpcEndpoint, ingestionPipelineEndpoint string,
 	describeToken string,
-	useOpenSearch bool) ([]string, error) {
+	useOpenSearch bool,
+	opts ...DescribeOption) ([]string, error) {
 	logger.Info("Making New Resource Sender")
-	rs, err := NewResourceSender(grpcEndpoint, ingestionPipelineEndpoint, describeToken, job.JobID, params, useOpenSearch, logger)
+	sink, err := NewSink(grpcEndpoint, ingestionPipelineEndpoint, useOpenSearch, job.JobID, params, ConnConfigFromParams(params, describeToken))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to resource sender: %w", err)
 	}
+	return DescribeToSink(ctx, logger, job, params, config, sink, opts...)
+}
 
-	logger.Info("Connect to steampipe plugin")
-	plg := global.Plugin()
-	logger.Info("Account Config From Map")
-	creds, err := provider.AccountCredentialsFromMap(config)
+// DescribeToSink describes job and sends the resources to sink, which it
+// closes. It returns the IDs of the described resources.
+func DescribeToSink(
+	ctx context.Context,
+	logger *zap.Logger,
+	job describe2.DescribeJob,
+	params map[string]string,
+	config map[string]any,
+	sink Sink,
+	opts ...DescribeOption) ([]string, error) {
+	o := describeOptions{deletionGuard: DeletionGuardFromParams(params)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.deletions && o.stateStore == nil && o.indexedClient == nil {
+		_ = sink.Close()
+		return nil, ErrNoKnownResources
+	}
+
+	creds, additionalParameters, builder, err := prepareDescribe(logger, job, config)
 	if err != nil {
-		return nil, fmt.Errorf(" account credentials: %w", err)
+		_ = sink.Close()
+		return nil, err
 	}
+	ctx = withStats(ctx)
+	rs := NewResourceSenderWithSink(sink, job.JobID, params, describers.GetStatsFromContext(ctx), logger)
 
-	f := func(resource model.Resource) error {
-		if resource.Description == nil {
-			return nil
-		}
-		descriptionJSON, err := json.Marshal(resource.Description)
+	// previous holds the states of the last describe, current the ones of this
+	// describe. Both stay nil without change detection. seen collects the
+	// produced PlatformIDs when deletions are detected.
+	var previous, current map[string]ResourceState
+	var unchanged []string
+	var seen map[string]struct{}
+	if o.detectDeletions() {
+		seen = make(map[string]struct{})
+	}
+	if o.stateStore != nil {
+		previous, err = o.stateStore.Load(ctx, job.IntegrationID, job.ResourceType)
 		if err != nil {
-			return fmt.Errorf("failed to marshal description: %w", err)
+			logger.Warn("failed to load resource states, sending every resource", zap.String("resourceType", job.ResourceType), zap.Error(err))
+			previous = nil
 		}
-		descriptionJSON, err = trimJsonFromEmptyObjects(descriptionJSON)
-		if err != nil {
-			return fmt.Errorf("failed to trim json: %w", err)
+		current = make(map[string]ResourceState)
+	}
+
+	// streamClosed stops accepting resources once Describe gives up on the
+	// describer, so a describer that ignores ctx cannot send after Finish.
+	var (
+		streamMu     sync.Mutex
+		streamClosed bool
+	)
+
+	f := func(resource model.Resource) error {
+		esResource, err := builder.Build(resource)
+		if err != nil || esResource == nil {
+			return err
 		}
 
-		metadata, err := provider.GetResourceMetadata(job, resource)
-		if err != nil {
-			return fmt.Errorf("failed to get resource metadata")
+		streamMu.Lock()
+		if streamClosed {
+			streamMu.Unlock()
+			return fmt.Errorf("describe of %s stopped: %w", job.ResourceType, context.Cause(ctx))
 		}
-		err = provider.AdjustResource(job, &resource)
-		if err != nil {
-			return fmt.Errorf("failed to get resource metadata")
+		if seen != nil {
+			seen[esResource.PlatformID] = struct{}{}
 		}
-
-		desc := resource.Description
-		err = json.Unmarshal(descriptionJSON, &desc)
-		if err != nil {
-			return fmt.Errorf("unmarshal description: %v", err.Error())
+		if current != nil {
+			hash := esResource.Metadata[ContentHashKey]
+			current[esResource.PlatformID] = resourceState(esResource, params, hash)
+			if prev, ok := previous[esResource.PlatformID]; ok && prev.Hash == hash {
+				unchanged = append(unchanged, esResource.ResourceID)
+				streamMu.Unlock()
+				return nil
+			}
 		}
+		streamMu.Unlock()
 
-		tags := make(map[string]string)
+		// Send can block on a slow sink, so it runs outside streamMu to let a
+		// timed out describe close the stream. A resource sent after that is
+		// dropped by the sender.
+		rs.Send(esResource)
+		return nil
+	}
+	clientStream := (*model.StreamSender)(&f)
 
-		if plg != nil {
-			tags, _, err = global.ExtractTagsAndNames(logger, plg, job.ResourceType, resource)
-			if err != nil {
-				logger.Error("failed to build tags for service", zap.Error(err), zap.String("resourceType", job.ResourceType), zap.Any("resource", resource))
+	// The describer runs in its own goroutine so that a describer stuck on a
+	// call that ignores ctx cannot hold the caller past its deadline.
+	describeErr := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("paniced while describing", zap.Any("recover", r), zap.String("resourceType", job.ResourceType))
+				describeErr <- fmt.Errorf("paniced while describing %s: %v", job.ResourceType, r)
 			}
-		}
+		}()
+		describeErr <- GetResources(
+			ctx,
+			logger,
+			job.ResourceType,
+			job.TriggerType,
+			creds,
+			additionalParameters,
+			clientStream,
+		)
+	}()
 
-		var description any
-		err = json.Unmarshal([]byte(descriptionJSON), &description)
-		if err != nil {
-			logger.Error("failed to parse resource description json", zap.Error(err))
-			return fmt.Errorf("failed to parse resource description json")
-		}
+	select {
+	case err = <-describeErr:
+	case <-ctx.Done():
+		err = fmt.Errorf("describe of %s stopped: %w", job.ResourceType, ctx.Err())
+	}
 
-		newTags := make([]es.Tag, 0, len(tags))
-		for k, v := range tags {
-			newTags = append(newTags, es.Tag{
-				// tags should be case-insensitive
-				Key:   strings.ToLower(k),
-				Value: strings.ToLower(v),
-			})
-		}
+	streamMu.Lock()
+	streamClosed = true
+	streamMu.Unlock()
 
-		rs.Send(&es.Resource{
-			PlatformID:      fmt.Sprintf("%s:::%s:::%s", job.IntegrationID, job.ResourceType, resource.UniqueID()),
-			ResourceID:      resource.UniqueID(),
-			ResourceName:    resource.Name,
-			Description:     description,
-			IntegrationType: constants.IntegrationName,
-			ResourceType:    strings.ToLower(job.ResourceType),
-			IntegrationID:   job.IntegrationID,
-			Metadata:        metadata,
-			CanonicalTags:   newTags,
-			DescribedAt:     job.DescribedAt,
-			DescribedBy:     strconv.FormatUint(uint64(job.JobID), 10),
-		})
-		return nil
+	if o.detectDeletions() {
+		sendDeletions(ctx, logger, rs, job, o, err, previous, seen)
+	}
+	if current != nil {
+		logger.Info("change detection", zap.String("resourceType", job.ResourceType), zap.Int("unchanged", len(unchanged)))
+	}
+
+	// Resources streamed so far are flushed even when the describe failed.
+	finishErr := rs.Finish()
+	var deliveryErr *DeliveryError
+	if errors.As(finishErr, &deliveryErr) {
+		deliveryErr.ResourceType = job.ResourceType
 	}
-	clientStream := (*model.StreamSender)(&f)
 
-	additionalParameters, err := provider.GetAdditionalParameters(job)
 	if err != nil {
+		if finishErr != nil {
+			logger.Error("failed to deliver resources", zap.String("resourceType", job.ResourceType), zap.Error(finishErr))
+		}
 		return nil, err
 	}
-	err = GetResources(
-		ctx,
-		logger,
-		job.ResourceType,
-		job.TriggerType,
-		creds,
-		additionalParameters,
-		clientStream,
-	)
+	if finishErr != nil {
+		return nil, finishErr
+	}
+	if current != nil {
+		if err := o.stateStore.Save(ctx, job.IntegrationID, job.ResourceType, current); err != nil {
+			logger.Warn("failed to save resource states", zap.String("resourceType", job.ResourceType), zap.Error(err))
+		}
+	}
+	return append(rs.GetResourceIDs(), unchanged...), nil
+}
+
+// DescribeSingleToSink describes the resource with resourceID and sends it to
+// sink, which it closes.
+func DescribeSingleToSink(
+	ctx context.Context,
+	logger *zap.Logger,
+	job describe2.DescribeJob,
+	params map[string]string,
+	config map[string]any,
+	resourceID string,
+	sink Sink) ([]string, error) {
+	creds, additionalParameters, builder, err := prepareDescribe(logger, job, config)
 	if err != nil {
+		_ = sink.Close()
 		return nil, err
 	}
+	ctx = withStats(ctx)
+	rs := NewResourceSenderWithSink(sink, job.JobID, params, describers.GetStatsFromContext(ctx), logger)
 
-	rs.Finish()
+	f := func(resource model.Resource) error {
+		esResource, err := builder.Build(resource)
+		if err != nil || esResource == nil {
+			return err
+		}
+		rs.Send(esResource)
+		return nil
+	}
+	err = GetSingleResource(ctx, logger, job.ResourceType, job.TriggerType, creds, additionalParameters, resourceID, (*model.StreamSender)(&f))
 
+	finishErr := rs.Finish()
+	if err != nil {
+		return nil, err
+	}
+	if finishErr != nil {
+		return nil, finishErr
+	}
 	return rs.GetResourceIDs(), nil
 }
+
+func prepareDescribe(logger *zap.Logger, job describe2.DescribeJob, config map[string]any) (model.IntegrationCredentials, map[string]string, *ResourceBuilder, error) {
+	logger.Info("Account Config From Map")
+	creds, err := provider.AccountCredentialsFromMap(config)
+	if err != nil {
+		return model.IntegrationCredentials{}, nil, nil, fmt.Errorf(" account credentials: %w", err)
+	}
+	additionalParameters, err := provider.GetAdditionalParameters(job)
+	if err != nil {
+		return model.IntegrationCredentials{}, nil, nil, err
+	}
+	builder, err := NewResourceBuilder(logger, job)
+	if err != nil {
+		return model.IntegrationCredentials{}, nil, nil, err
+	}
+	return creds, additionalParameters, builder, nil
+}
@@ -0,0 +1,18 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	describe2 "github.com/opengovern/og-util/pkg/describe"
+	"go.uber.org/zap"
+)
+
+func TestDescribeToSinkDeletionsNeedKnownResources(t *testing.T) {
+	job := describe2.DescribeJob{JobID: 1, ResourceType: "Github/Repository"}
+	_, err := DescribeToSink(context.Background(), zap.NewNop(), job, map[string]string{}, nil, NewMemorySink(), WithDeletionDetection())
+	if !errors.Is(err, ErrNoKnownResources) {
+		t.Fatalf("DescribeToSink() error = %v, want ErrNoKnownResources", err)
+	}
+}
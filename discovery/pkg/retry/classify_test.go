@@ -0,0 +1,61 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "unknown error", err: errors.New("invalid credentials"), want: false},
+		{name: "marked retryable", err: Retryable(errors.New("invalid credentials")), want: true},
+		{name: "marked permanent", err: Permanent(io.EOF), want: false},
+		{name: "wrapped permanent", err: fmt.Errorf("describe: %w", Permanent(io.EOF)), want: false},
+		{name: "cancelled", err: context.Canceled, want: false},
+		{name: "deadline exceeded", err: fmt.Errorf("query: %w", context.DeadlineExceeded), want: false},
+		{name: "grpc unavailable", err: status.Error(codes.Unavailable, "down"), want: true},
+		{name: "grpc resource exhausted", err: status.Error(codes.ResourceExhausted, "slow down"), want: true},
+		{name: "grpc aborted", err: status.Error(codes.Aborted, "conflict"), want: true},
+		{name: "grpc deadline exceeded", err: status.Error(codes.DeadlineExceeded, "late"), want: true},
+		{name: "grpc invalid argument", err: status.Error(codes.InvalidArgument, "bad"), want: false},
+		{name: "grpc permission denied", err: status.Error(codes.PermissionDenied, "connection reset by peer"), want: false},
+		{name: "grpc unknown falls back to the message", err: status.Error(codes.Unknown, "503 Service Unavailable"), want: true},
+		{name: "eof", err: fmt.Errorf("read: %w", io.EOF), want: true},
+		{name: "unexpected eof", err: io.ErrUnexpectedEOF, want: true},
+		{name: "connection refused", err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED), want: true},
+		{name: "connection reset", err: syscall.ECONNRESET, want: true},
+		{name: "net error", err: &net.DNSError{Err: "no such host", Name: "core", IsTemporary: true}, want: true},
+		{name: "transient message", err: errors.New("Get \"http://core\": dial tcp: connect: connection refused"), want: true},
+		{name: "too many requests message", err: errors.New("status 429: Too Many Requests"), want: true},
+		{name: "bad gateway message", err: errors.New("502 Bad Gateway"), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkersKeepNil(t *testing.T) {
+	if Permanent(nil) != nil {
+		t.Error("Permanent(nil) != nil")
+	}
+	if Retryable(nil) != nil {
+		t.Error("Retryable(nil) != nil")
+	}
+}
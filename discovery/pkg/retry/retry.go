@@ -0,0 +1,138 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts  = 10
+	DefaultInitialDelay = time.Second
+	DefaultMaxDelay     = 30 * time.Second
+	DefaultMultiplier   = 2.0
+	DefaultJitter       = 0.2
+)
+
+// Policy describes how often and how long to wait before retrying an operation.
+// The delay grows exponentially from InitialDelay up to MaxDelay, and Jitter
+// randomises it by the given fraction in both directions.
+type Policy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	Jitter       float64
+
+	// OnRetry, when set, is called before sleeping for the next attempt.
+	OnRetry func(operation string, attempt int, err error, delay time.Duration)
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts:  DefaultMaxAttempts,
+		InitialDelay: DefaultInitialDelay,
+		MaxDelay:     DefaultMaxDelay,
+		Multiplier:   DefaultMultiplier,
+		Jitter:       DefaultJitter,
+	}
+}
+
+// PolicyFromParams builds a policy from the task params retry_max_attempts,
+// retry_initial_delay and retry_max_delay. Delays are Go durations ("500ms",
+// "1m") or plain seconds.
+func PolicyFromParams(params map[string]string) Policy {
+	p := DefaultPolicy()
+	if v, ok := params["retry_max_attempts"]; ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+			p.MaxAttempts = n
+		}
+	}
+	if d, ok := parseDuration(params["retry_initial_delay"]); ok {
+		p.InitialDelay = d
+	}
+	if d, ok := parseDuration(params["retry_max_delay"]); ok {
+		p.MaxDelay = d
+	}
+	if p.MaxDelay < p.InitialDelay {
+		p.MaxDelay = p.InitialDelay
+	}
+	return p
+}
+
+func parseDuration(v string) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return d, true
+	}
+	if s, err := strconv.ParseFloat(v, 64); err == nil && s >= 0 {
+		return time.Duration(s * float64(time.Second)), true
+	}
+	return 0, false
+}
+
+// Backoff returns the delay to wait after the given failed attempt, starting at 1.
+func (p Policy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// Do runs fn until it succeeds, returns a permanent error, the attempts are
+// exhausted or ctx is done. Only errors classified as retryable by IsRetryable
+// are retried.
+func Do[T any](ctx context.Context, p Policy, operation string, fn func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	maxAttempts := p.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var result T
+		result, err = fn(ctx)
+		if err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil || !IsRetryable(err) {
+			return zero, unwrapPermanent(err)
+		}
+		if attempt == maxAttempts {
+			break
+		}
+
+		delay := p.Backoff(attempt)
+		if p.OnRetry != nil {
+			p.OnRetry(operation, attempt, err, delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return zero, fmt.Errorf("%s cancelled while retrying: %w", operation, ctx.Err())
+		case <-timer.C:
+		}
+	}
+
+	return zero, fmt.Errorf("failed to complete %s after %d attempts: %w", operation, maxAttempts, err)
+}
@@ -0,0 +1,165 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := Policy{InitialDelay: time.Second, MaxDelay: 10 * time.Second, Multiplier: 2}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: time.Second},
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 3, want: 4 * time.Second},
+		{attempt: 4, want: 8 * time.Second},
+		{attempt: 5, want: 10 * time.Second},
+		{attempt: 50, want: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.Backoff(tt.attempt); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffMultiplierBelowOne(t *testing.T) {
+	p := Policy{InitialDelay: time.Second, Multiplier: 0.5}
+	if got := p.Backoff(3); got != time.Second {
+		t.Errorf("Backoff(3) = %s, want %s", got, time.Second)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	p := Policy{InitialDelay: time.Second, MaxDelay: time.Second, Multiplier: 2, Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		got := p.Backoff(3)
+		if got < 800*time.Millisecond || got > 1200*time.Millisecond {
+			t.Fatalf("Backoff(3) = %s, want within 20%% of 1s", got)
+		}
+	}
+}
+
+func TestPolicyFromParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]string
+		want   Policy
+	}{
+		{
+			name:   "defaults",
+			params: nil,
+			want:   DefaultPolicy(),
+		},
+		{
+			name: "durations and seconds",
+			params: map[string]string{
+				"retry_max_attempts":  "3",
+				"retry_initial_delay": "500ms",
+				"retry_max_delay":     "2.5",
+			},
+			want: Policy{MaxAttempts: 3, InitialDelay: 500 * time.Millisecond, MaxDelay: 2500 * time.Millisecond,
+				Multiplier: DefaultMultiplier, Jitter: DefaultJitter},
+		},
+		{
+			name: "invalid values are ignored",
+			params: map[string]string{
+				"retry_max_attempts":  "0",
+				"retry_initial_delay": "-1s",
+				"retry_max_delay":     "soon",
+			},
+			want: DefaultPolicy(),
+		},
+		{
+			name:   "max delay is at least the initial delay",
+			params: map[string]string{"retry_initial_delay": "1m", "retry_max_delay": "1s"},
+			want: Policy{MaxAttempts: DefaultMaxAttempts, InitialDelay: time.Minute, MaxDelay: time.Minute,
+				Multiplier: DefaultMultiplier, Jitter: DefaultJitter},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PolicyFromParams(tt.params)
+			got.OnRetry = nil
+			if got.MaxAttempts != tt.want.MaxAttempts || got.InitialDelay != tt.want.InitialDelay ||
+				got.MaxDelay != tt.want.MaxDelay || got.Multiplier != tt.want.Multiplier || got.Jitter != tt.want.Jitter {
+				t.Errorf("PolicyFromParams() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	transient := Retryable(errors.New("transient"))
+	permanent := errors.New("permanent")
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{name: "succeeds at once", errs: nil, wantAttempts: 1},
+		{name: "succeeds after retries", errs: []error{transient, transient}, wantAttempts: 3},
+		{name: "permanent error stops", errs: []error{transient, permanent}, wantAttempts: 2, wantErr: permanent},
+		{name: "unwraps Permanent", errs: []error{Permanent(permanent)}, wantAttempts: 1, wantErr: permanent},
+		{name: "attempts exhausted", errs: []error{transient, transient, transient, transient}, wantAttempts: 3, wantErr: transient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, Multiplier: 1}
+			retries := 0
+			p.OnRetry = func(string, int, error, time.Duration) { retries++ }
+
+			attempts := 0
+			got, err := Do(context.Background(), p, "op", func(context.Context) (int, error) {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return 0, tt.errs[attempts-1]
+				}
+				return 42, nil
+			})
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if retries != attempts-1 {
+				t.Errorf("OnRetry called %d times, want %d", retries, attempts-1)
+			}
+			if tt.wantErr == nil {
+				if err != nil || got != 42 {
+					t.Errorf("Do() = %d, %v, want 42, nil", got, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, want %v", err, tt.wantErr)
+			}
+			if _, ok := err.(permanentError); ok {
+				t.Errorf("Do() returned the Permanent wrapper")
+			}
+		})
+	}
+}
+
+func TestDoStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Policy{MaxAttempts: 5, InitialDelay: time.Hour}
+	p.OnRetry = func(string, int, error, time.Duration) { cancel() }
+
+	attempts := 0
+	_, err := Do(ctx, p, "op", func(context.Context) (int, error) {
+		attempts++
+		return 0, Retryable(errors.New("transient"))
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() error = %v, want context.Canceled", err)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+}
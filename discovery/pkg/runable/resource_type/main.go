@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"github.com/opengovern/og-describer-template/global/constants"
 	"os"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -29,6 +31,16 @@ type ResourceType struct {
 	LabelsString      string `json:"-"`
 	Params            []interfaces.Param
 	ParamsString      string `json:"-"`
+	Redactions        []RedactionRule
+	RedactionsString  string `json:"-"`
+}
+
+// RedactionRule masks or hashes description fields, or the matches of Pattern
+// in them, before resources are sent.
+type RedactionRule struct {
+	Field   string
+	Pattern string
+	Action  string
 }
 
 var (
@@ -66,6 +78,8 @@ func main() {
 		Annotations:          {{ .AnnotationsString }},
 		ListDescriber:        provider.{{ .ListDescriber }},
 		GetDescriber:         {{ if .GetDescriber }}provider.{{ .GetDescriber }}{{ else }}nil{{ end }},
+		{{ if .RedactionsString }}Redactions:           {{ .RedactionsString }},
+		{{ end }}
 	},
 `))
 	if err != nil {
@@ -170,6 +184,23 @@ var ResourceTypes = map[string]model.ResourceType{
 		annotationsStringBuilder.WriteString("        }")
 		resourceType.AnnotationsString = annotationsStringBuilder.String()
 
+		// Build RedactionsString, keeping the order of the rules
+		if len(resourceType.Redactions) > 0 {
+			redactionsStringBuilder := strings.Builder{}
+			redactionsStringBuilder.WriteString("[]model.RedactionRule{\n")
+			for _, r := range resourceType.Redactions {
+				if r.Pattern != "" {
+					if _, err := regexp.Compile(r.Pattern); err != nil {
+						panic(fmt.Sprintf("invalid redaction pattern for %s: %v", resourceType.ResourceName, err))
+					}
+				}
+				redactionsStringBuilder.WriteString(fmt.Sprintf("            {Field: %s, Pattern: %s, Action: %s},\n",
+					strconv.Quote(r.Field), strconv.Quote(r.Pattern), strconv.Quote(r.Action)))
+			}
+			redactionsStringBuilder.WriteString("        }")
+			resourceType.RedactionsString = redactionsStringBuilder.String()
+		}
+
 		// Execute the template with the current resourceType
 		err = tmpl.Execute(b, resourceType)
 		if err != nil {
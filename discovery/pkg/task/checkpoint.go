@@ -0,0 +1,154 @@
+package task
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/opengovern/og-describer-template/global"
+	"github.com/opengovern/og-util/pkg/jq"
+	"go.uber.org/zap"
+)
+
+const (
+	checkpointBucket = global.StreamName + "_task_checkpoints"
+	checkpointTTL    = 7 * 24 * time.Hour
+)
+
+type checkpointEntry struct {
+	IntegrationID string             `json:"integration_id"`
+	Result        ResourceTypeResult `json:"result"`
+}
+
+// checkpointStore keeps the (integration, resource type) pairs a task run has
+// already finished in a NATS KV bucket, keyed by RunID. When JetStream
+// redelivers a task after a worker restart the runner skips those pairs and
+// reuses their earlier results.
+//
+// A nil *checkpointStore is valid and disables checkpointing.
+type checkpointStore struct {
+	kv     jetstream.KeyValue
+	runID  uint
+	logger *zap.Logger
+
+	mu        sync.RWMutex
+	completed map[string]map[string]ResourceTypeResult
+}
+
+func newCheckpointStore(ctx context.Context, jq *jq.JobQueue, runID uint, logger *zap.Logger) (*checkpointStore, error) {
+	kv, err := jq.CreateOrUpdateKeyValueBucket(ctx, jetstream.KeyValueConfig{
+		Bucket:      checkpointBucket,
+		Description: "finished resource types of describe task runs",
+		TTL:         checkpointTTL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint bucket %s: %w", checkpointBucket, err)
+	}
+
+	c := &checkpointStore{
+		kv:        kv,
+		runID:     runID,
+		logger:    logger,
+		completed: make(map[string]map[string]ResourceTypeResult),
+	}
+	if err := c.load(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load reads every checkpoint of the run. The watcher first replays the
+// current values and then sends a nil entry, at which point we stop.
+func (c *checkpointStore) load(ctx context.Context) error {
+	watcher, err := c.kv.Watch(ctx, fmt.Sprintf("%d.>", c.runID), jetstream.IgnoreDeletes())
+	if err != nil {
+		return fmt.Errorf("failed to watch checkpoints: %w", err)
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case entry := <-watcher.Updates():
+			if entry == nil {
+				return nil
+			}
+			var ce checkpointEntry
+			if err := json.Unmarshal(entry.Value(), &ce); err != nil {
+				c.logger.Warn("ignoring invalid checkpoint", zap.String("key", entry.Key()), zap.Error(err))
+				continue
+			}
+			if _, ok := c.completed[ce.IntegrationID]; !ok {
+				c.completed[ce.IntegrationID] = make(map[string]ResourceTypeResult)
+			}
+			c.completed[ce.IntegrationID][ce.Result.ResourceType] = ce.Result
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *checkpointStore) count() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	n := 0
+	for _, rts := range c.completed {
+		n += len(rts)
+	}
+	return n
+}
+
+// get returns the checkpointed result of a pair, if the run already finished it.
+func (c *checkpointStore) get(integrationID, resourceType string) (ResourceTypeResult, bool) {
+	if c == nil {
+		return ResourceTypeResult{}, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	result, ok := c.completed[integrationID][resourceType]
+	return result, ok
+}
+
+// save records a finished pair. Only successful results are checkpointed so
+// that failed resource types get another chance when the run is resumed.
+func (c *checkpointStore) save(ctx context.Context, integrationID string, result ResourceTypeResult) error {
+	if c == nil || result.Error != "" {
+		return nil
+	}
+
+	value, err := json.Marshal(checkpointEntry{
+		IntegrationID: integrationID,
+		Result:        result,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = c.kv.Put(ctx, c.key(integrationID, result.ResourceType), value); err != nil {
+		return fmt.Errorf("failed to store checkpoint: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.completed[integrationID]; !ok {
+		c.completed[integrationID] = make(map[string]ResourceTypeResult)
+	}
+	c.completed[integrationID][result.ResourceType] = result
+	return nil
+}
+
+// key builds "<runID>.<integration>.<resource type>". Integration ids and
+// resource type names are base64 encoded since they may contain characters
+// that are not allowed in KV keys.
+func (c *checkpointStore) key(integrationID, resourceType string) string {
+	return fmt.Sprintf("%d.%s.%s", c.runID,
+		base64.RawURLEncoding.EncodeToString([]byte(integrationID)),
+		base64.RawURLEncoding.EncodeToString([]byte(resourceType)))
+}
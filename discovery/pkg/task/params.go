@@ -0,0 +1,103 @@
+package task
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// intParam reads an integer task parameter. Task params are decoded from JSON,
+// so numbers usually arrive as float64, but string values are accepted too.
+func intParam(params map[string]any, key string, defaultValue int) int {
+	v, ok := params[key]
+	if !ok || v == nil {
+		return defaultValue
+	}
+	switch vv := v.(type) {
+	case int:
+		return vv
+	case int64:
+		return int(vv)
+	case float64:
+		return int(vv)
+	case string:
+		if n, err := strconv.Atoi(strings.TrimSpace(vv)); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+// boolParam reads a boolean task parameter, given as a JSON boolean or as a
+// string accepted by strconv.ParseBool.
+func boolParam(params map[string]any, key string, defaultValue bool) bool {
+	v, ok := params[key]
+	if !ok || v == nil {
+		return defaultValue
+	}
+	switch vv := v.(type) {
+	case bool:
+		return vv
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(vv)); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+// stringParams renders the task params the way describers receive them.
+func stringParams(params map[string]any) map[string]string {
+	result := make(map[string]string, len(params))
+	for key, value := range params {
+		result[key] = fmt.Sprintf("%v", value)
+	}
+	return result
+}
+
+// listParam reads a list task parameter, given either as a JSON array or as a
+// comma separated string.
+func listParam(params map[string]any, key string) []string {
+	var values []string
+	switch v := params[key].(type) {
+	case string:
+		values = strings.Split(v, ",")
+	case []string:
+		values = v
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// durationValue parses a duration given as a Go duration string ("90s", "1h")
+// or as a number of seconds.
+func durationValue(v any) (time.Duration, bool) {
+	switch vv := v.(type) {
+	case float64:
+		return time.Duration(vv * float64(time.Second)), true
+	case int:
+		return time.Duration(vv) * time.Second, true
+	case string:
+		vv = strings.TrimSpace(vv)
+		if d, err := time.ParseDuration(vv); err == nil {
+			return d, true
+		}
+		if secs, err := strconv.ParseFloat(vv, 64); err == nil {
+			return time.Duration(secs * float64(time.Second)), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,175 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/opengovern/og-describer-template/discovery/envs"
+	"github.com/opengovern/opensecurity/services/tasks/scheduler"
+	"go.uber.org/zap"
+)
+
+// publisher publishes task results, it is implemented by *jq.JobQueue.
+type publisher interface {
+	Produce(ctx context.Context, topic string, data []byte, id string) (uint64, error)
+}
+
+// progressReporter owns the TaskResult while resource types are described
+// concurrently. Every update happens under a single lock and each finished
+// resource type is published to the result topic before the lock is released,
+// so progress messages go out in the order the items finish.
+type progressReporter struct {
+	mu sync.Mutex
+
+	pub      publisher
+	logger   *zap.Logger
+	runID    uint
+	result   *TaskResult
+	response *scheduler.TaskResponse
+}
+
+func newProgressReporter(pub publisher, logger *zap.Logger, runID uint, result *TaskResult, response *scheduler.TaskResponse) *progressReporter {
+	return &progressReporter{
+		pub:      pub,
+		logger:   logger,
+		runID:    runID,
+		result:   result,
+		response: response,
+	}
+}
+
+func (p *progressReporter) startIntegration(integrationID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.result.ProgressedIntegrations[integrationID] = &IntegrationResult{
+		IntegrationID: integrationID,
+		Status:        IntegrationStatusInProgress,
+	}
+	p.result.ProgressedIntegrationsCount++
+}
+
+func (p *progressReporter) setResourceTypes(integrationID string, resourceTypes []ResourceType) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ir := p.result.ProgressedIntegrations[integrationID]
+	for _, rt := range resourceTypes {
+		ir.AllResourceTypes = append(ir.AllResourceTypes, rt.Name)
+	}
+	ir.AllResourceTypesCount = len(resourceTypes)
+}
+
+// finishResourceType records the result of a single resource type and
+// publishes the updated task result.
+func (p *progressReporter) finishResourceType(ctx context.Context, integrationID string, rtResult ResourceTypeResult) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ir := p.result.ProgressedIntegrations[integrationID]
+	ir.ResourceTypeResults = append(ir.ResourceTypeResults, rtResult)
+	ir.FinishedResourceTypesCount = len(ir.ResourceTypeResults)
+
+	return p.publish(ctx)
+}
+
+// finishIntegration settles the status of an integration once all of its
+// resource types are done. err is the integration level failure, if any.
+func (p *progressReporter) finishIntegration(ctx context.Context, integrationID string, err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ir := p.result.ProgressedIntegrations[integrationID]
+	failed := 0
+	for _, r := range ir.ResourceTypeResults {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	succeeded := len(ir.ResourceTypeResults) - failed
+
+	switch {
+	case err != nil && succeeded > 0:
+		ir.Status = IntegrationStatusPartial
+		ir.Error = err.Error()
+	case err != nil:
+		ir.Status = IntegrationStatusFailed
+		ir.Error = err.Error()
+	case failed == 0:
+		ir.Status = IntegrationStatusSucceeded
+	case succeeded == 0:
+		ir.Status = IntegrationStatusFailed
+		ir.Error = fmt.Sprintf("all %d resource types failed", failed)
+	default:
+		ir.Status = IntegrationStatusPartial
+		ir.Error = fmt.Sprintf("%d of %d resource types failed", failed, len(ir.ResourceTypeResults))
+	}
+
+	switch ir.Status {
+	case IntegrationStatusFailed:
+		p.result.FailedIntegrationsCount++
+	case IntegrationStatusPartial:
+		p.result.PartialIntegrationsCount++
+	}
+
+	return p.publish(ctx)
+}
+
+// finalize stores the final task result on the response without publishing it,
+// the worker publishes the final response itself. A *FinishedWithErrorsError is
+// returned when any integration failed or was only partially described.
+func (p *progressReporter) finalize() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	failed := make(map[string]string)
+	partial := make(map[string]string)
+	for id, ir := range p.result.ProgressedIntegrations {
+		switch ir.Status {
+		case IntegrationStatusFailed:
+			failed[id] = ir.Error
+		case IntegrationStatusPartial:
+			partial[id] = ir.Error
+		}
+	}
+	p.result.Status = TaskResultStatusFinished
+	if len(failed) > 0 || len(partial) > 0 {
+		p.result.Status = TaskResultStatusFinishedWithErrors
+	}
+
+	jsonBytes, err := json.Marshal(p.result)
+	if err != nil {
+		return fmt.Errorf("failed Marshaling task result: %s", err.Error())
+	}
+	p.response.Result = jsonBytes
+
+	if p.result.Status == TaskResultStatusFinishedWithErrors {
+		return &FinishedWithErrorsError{
+			TotalIntegrations:   p.result.AllIntegrationsCount,
+			FailedIntegrations:  failed,
+			PartialIntegrations: partial,
+		}
+	}
+	return nil
+}
+
+func (p *progressReporter) publish(ctx context.Context) error {
+	jsonBytes, err := json.Marshal(p.result)
+	if err != nil {
+		return fmt.Errorf("failed Marshaling task result: %s", err.Error())
+	}
+	p.response.Result = jsonBytes
+	responseJson, err := json.Marshal(p.response)
+	if err != nil {
+		p.logger.Error("failed to create job result json", zap.Error(err))
+		return err
+	}
+	msgId := fmt.Sprintf("task-run-result-%d", p.runID)
+	if _, err = p.pub.Produce(ctx, envs.ResultTopicName, responseJson, msgId); err != nil {
+		p.logger.Error("failed to publish job progress", zap.String("response", string(responseJson)), zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/opengovern/opensecurity/services/tasks/scheduler"
+	"go.uber.org/zap"
+)
+
+// fakePublisher keeps the task results it publishes. From the failAt-th call
+// on, when set, publishing fails.
+type fakePublisher struct {
+	mu      sync.Mutex
+	calls   int
+	failAt  int
+	results []TaskResult
+}
+
+func (p *fakePublisher) Produce(_ context.Context, _ string, data []byte, _ string) (uint64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.failAt > 0 && p.calls >= p.failAt {
+		return 0, errors.New("nats unavailable")
+	}
+	var response scheduler.TaskResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return 0, err
+	}
+	var result TaskResult
+	if err := json.Unmarshal(response.Result, &result); err != nil {
+		return 0, err
+	}
+	p.results = append(p.results, result)
+	return uint64(p.calls), nil
+}
+
+func (p *fakePublisher) published() []TaskResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]TaskResult(nil), p.results...)
+}
+
+// finishedResourceTypes counts the resource types finished in result.
+func finishedResourceTypes(result TaskResult) int {
+	n := 0
+	for _, ir := range result.ProgressedIntegrations {
+		n += ir.FinishedResourceTypesCount
+	}
+	return n
+}
+
+func newTestProgress(pub publisher) (*progressReporter, *TaskResult, *scheduler.TaskResponse) {
+	result := &TaskResult{ProgressedIntegrations: make(map[string]*IntegrationResult)}
+	response := &scheduler.TaskResponse{}
+	return newProgressReporter(pub, zap.NewNop(), 1, result, response), result, response
+}
+
+func TestFinishIntegrationStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		errors     []string
+		err        error
+		wantStatus IntegrationStatus
+		wantError  string
+	}{
+		{name: "all succeeded", errors: []string{"", ""}, wantStatus: IntegrationStatusSucceeded},
+		{name: "some failed", errors: []string{"", "boom"}, wantStatus: IntegrationStatusPartial, wantError: "1 of 2 resource types failed"},
+		{name: "all failed", errors: []string{"boom", "boom"}, wantStatus: IntegrationStatusFailed, wantError: "all 2 resource types failed"},
+		{name: "integration error after successes", errors: []string{""}, err: errors.New("context canceled"), wantStatus: IntegrationStatusPartial, wantError: "context canceled"},
+		{name: "integration error", err: errors.New("decrypt error"), wantStatus: IntegrationStatusFailed, wantError: "decrypt error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &fakePublisher{}
+			p, result, _ := newTestProgress(pub)
+			ctx := context.Background()
+			p.startIntegration("integration")
+			for _, e := range tt.errors {
+				if err := p.finishResourceType(ctx, "integration", ResourceTypeResult{ResourceType: "Github/Repository", Error: e}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := p.finishIntegration(ctx, "integration", tt.err); err != nil {
+				t.Fatal(err)
+			}
+
+			ir := result.ProgressedIntegrations["integration"]
+			if ir.Status != tt.wantStatus || ir.Error != tt.wantError {
+				t.Errorf("status %s %q, want %s %q", ir.Status, ir.Error, tt.wantStatus, tt.wantError)
+			}
+			wantFailed, wantPartial := 0, 0
+			switch tt.wantStatus {
+			case IntegrationStatusFailed:
+				wantFailed = 1
+			case IntegrationStatusPartial:
+				wantPartial = 1
+			}
+			if result.FailedIntegrationsCount != wantFailed || result.PartialIntegrationsCount != wantPartial {
+				t.Errorf("%d failed and %d partial integrations, want %d and %d",
+					result.FailedIntegrationsCount, result.PartialIntegrationsCount, wantFailed, wantPartial)
+			}
+			published := pub.published()
+			if len(published) != len(tt.errors)+1 {
+				t.Fatalf("published %d results, want %d", len(published), len(tt.errors)+1)
+			}
+			if last := published[len(published)-1].ProgressedIntegrations["integration"]; last.Status != tt.wantStatus {
+				t.Errorf("last published status %s, want %s", last.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	statuses := map[string]error{
+		"succeeded": nil,
+		"failed":    errors.New("decrypt error"),
+	}
+	p, result, response := newTestProgress(&fakePublisher{})
+	ctx := context.Background()
+	for id, err := range statuses {
+		p.startIntegration(id)
+		if err := p.finishIntegration(ctx, id, err); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.startIntegration("partial")
+	for _, e := range []string{"", "boom"} {
+		if err := p.finishResourceType(ctx, "partial", ResourceTypeResult{Error: e}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.finishIntegration(ctx, "partial", nil); err != nil {
+		t.Fatal(err)
+	}
+	result.AllIntegrationsCount = 3
+
+	var ferr *FinishedWithErrorsError
+	if err := p.finalize(); !errors.As(err, &ferr) {
+		t.Fatalf("finalize() = %v, want a FinishedWithErrorsError", err)
+	}
+	if _, ok := ferr.FailedIntegrations["failed"]; !ok || len(ferr.FailedIntegrations) != 1 {
+		t.Errorf("failed integrations %v, want only failed", ferr.FailedIntegrations)
+	}
+	if _, ok := ferr.PartialIntegrations["partial"]; !ok || len(ferr.PartialIntegrations) != 1 {
+		t.Errorf("partial integrations %v, want only partial", ferr.PartialIntegrations)
+	}
+	var final TaskResult
+	if err := json.Unmarshal(response.Result, &final); err != nil {
+		t.Fatal(err)
+	}
+	if final.Status != TaskResultStatusFinishedWithErrors {
+		t.Errorf("final status %s, want %s", final.Status, TaskResultStatusFinishedWithErrors)
+	}
+}
+
+func TestFinalizeSucceeded(t *testing.T) {
+	p, _, response := newTestProgress(&fakePublisher{})
+	p.startIntegration("integration")
+	if err := p.finishIntegration(context.Background(), "integration", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.finalize(); err != nil {
+		t.Fatalf("finalize() = %v, want nil", err)
+	}
+	var final TaskResult
+	if err := json.Unmarshal(response.Result, &final); err != nil {
+		t.Fatal(err)
+	}
+	if final.Status != TaskResultStatusFinished {
+		t.Errorf("final status %s, want %s", final.Status, TaskResultStatusFinished)
+	}
+}
@@ -3,9 +3,13 @@ package task
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/opengovern/og-describer-template/discovery/envs"
+	"github.com/opengovern/og-describer-template/discovery/describers"
+	"github.com/opengovern/og-describer-template/discovery/pkg/credentials"
+	model "github.com/opengovern/og-describer-template/discovery/pkg/models"
 	"github.com/opengovern/og-describer-template/discovery/pkg/orchestrator"
+	"github.com/opengovern/og-describer-template/discovery/pkg/retry"
 	authApi "github.com/opengovern/og-util/pkg/api"
 	"github.com/opengovern/og-util/pkg/describe"
 	"github.com/opengovern/og-util/pkg/httpclient"
@@ -13,16 +17,35 @@ import (
 	"github.com/opengovern/og-util/pkg/jq"
 	"github.com/opengovern/og-util/pkg/opengovernance-es-sdk"
 	"github.com/opengovern/og-util/pkg/tasks"
-	"github.com/opengovern/og-util/pkg/vault"
 	coreApi "github.com/opengovern/opensecurity/services/core/api"
 	coreClient "github.com/opengovern/opensecurity/services/core/client"
 	"github.com/opengovern/opensecurity/services/tasks/scheduler"
 	"go.uber.org/zap"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	defaultDescribeConcurrency            = 10
+	defaultIntegrationDescribeConcurrency = 3
+
+	maxReportedFailures = 20
+
+	defaultQueryPageSize = 1000
+	defaultQueryMaxRows  = 100000
+
+	describeTimeoutKey     = "describe_timeout"
+	defaultDescribeTimeout = 25 * time.Minute
+	describeTimeoutError   = "timeout"
+)
+
+var errDescribeTimeout = errors.New("describe timed out")
+
 type TaskRunner struct {
-	vaultSrc            vault.VaultSourceConfig
+	credentialSrc       credentials.CredentialSource
 	jq                  *jq.JobQueue
 	coreServiceEndpoint string
 	describeToken       string
@@ -30,28 +53,73 @@ type TaskRunner struct {
 	logger              *zap.Logger
 	request             tasks.TaskRequest
 	response            *scheduler.TaskResponse
+
+	// describeSlots bounds the number of concurrent orchestrator.Describe calls
+	// across all integrations, integrationConcurrency bounds them per integration.
+	// integrationSlots bounds the integrations being described at once.
+	describeSlots          chan struct{}
+	integrationConcurrency int
+	integrationSlots       chan struct{}
+
+	checkpoints *checkpointStore
+	retryPolicy retry.Policy
+	stateStore  orchestrator.ResourceStateStore
+
+	// describe describes a single job, it is describeJob outside of tests.
+	describe func(ctx context.Context, job describe.DescribeJob, params map[string]string, config map[string]any) ([]string, error)
 }
 
 func NewTaskRunner(ctx context.Context, jq *jq.JobQueue, coreServiceEndpoint string, describeToken string, esClient opengovernance.Client,
 	logger *zap.Logger, request tasks.TaskRequest, response *scheduler.TaskResponse) (*TaskRunner, error) {
 
-	vaultSc, err := vault.NewHashiCorpVaultClient(ctx, logger, request.VaultConfig.HashiCorp, request.VaultConfig.KeyId)
+	credentialSrc, err := credentials.NewCredentialSource(ctx, logger, request.VaultConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize credential source: %w", err)
+	}
+
+	describeConcurrency := intParam(request.TaskDefinition.Params, "describe_concurrency", defaultDescribeConcurrency)
+	if describeConcurrency < 1 {
+		describeConcurrency = 1
+	}
+	integrationConcurrency := intParam(request.TaskDefinition.Params, "integration_describe_concurrency", defaultIntegrationDescribeConcurrency)
+	if integrationConcurrency < 1 {
+		integrationConcurrency = 1
+	}
+	// More integrations than describe slots would only wait on them, after
+	// decrypting their credentials.
+	maxConcurrentIntegrations := intParam(request.TaskDefinition.Params, "max_concurrent_integrations", describeConcurrency)
+	if maxConcurrentIntegrations < 1 {
+		maxConcurrentIntegrations = 1
+	}
+
+	stateStore, err := orchestrator.ResourceStateStoreFromParams(stringParams(request.TaskDefinition.Params), esClient)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize HashiCorp vault: %w", err)
+		return nil, err
 	}
 
-	logger.Info("Vault setup complete")
+	retryPolicy := retry.PolicyFromParams(stringParams(request.TaskDefinition.Params))
+	retryPolicy.OnRetry = func(operation string, attempt int, err error, delay time.Duration) {
+		logger.Warn("retrying operation", zap.String("operation", operation), zap.Int("attempt", attempt),
+			zap.Duration("delay", delay), zap.Error(err))
+	}
 
-	return &TaskRunner{
-		vaultSrc:            vaultSc,
-		jq:                  jq,
-		coreServiceEndpoint: coreServiceEndpoint,
-		describeToken:       describeToken,
-		esClient:            esClient,
-		logger:              logger,
-		request:             request,
-		response:            response,
-	}, nil
+	tr := &TaskRunner{
+		credentialSrc:          credentialSrc,
+		jq:                     jq,
+		coreServiceEndpoint:    coreServiceEndpoint,
+		describeToken:          describeToken,
+		esClient:               esClient,
+		logger:                 logger,
+		request:                request,
+		response:               response,
+		describeSlots:          make(chan struct{}, describeConcurrency),
+		integrationConcurrency: integrationConcurrency,
+		integrationSlots:       make(chan struct{}, maxConcurrentIntegrations),
+		retryPolicy:            retryPolicy,
+		stateStore:             stateStore,
+	}
+	tr.describe = tr.describeJob
+	return tr, nil
 }
 
 type TaskResult struct {
@@ -59,10 +127,31 @@ type TaskResult struct {
 	AllIntegrationsCount        int                           `json:"all_integrations_count"`
 	ProgressedIntegrations      map[string]*IntegrationResult `json:"progressed_integrations"`
 	ProgressedIntegrationsCount int                           `json:"progressed_integrations_count"`
+	FailedIntegrationsCount     int                           `json:"failed_integrations_count"`
+	PartialIntegrationsCount    int                           `json:"partial_integrations_count"`
+	Status                      TaskResultStatus              `json:"status,omitempty"`
 }
 
+type TaskResultStatus string
+
+const (
+	TaskResultStatusFinished           TaskResultStatus = "finished"
+	TaskResultStatusFinishedWithErrors TaskResultStatus = "finished_with_errors"
+)
+
+type IntegrationStatus string
+
+const (
+	IntegrationStatusInProgress IntegrationStatus = "in_progress"
+	IntegrationStatusSucceeded  IntegrationStatus = "succeeded"
+	IntegrationStatusPartial    IntegrationStatus = "partial"
+	IntegrationStatusFailed     IntegrationStatus = "failed"
+)
+
 type IntegrationResult struct {
 	IntegrationID              string               `json:"integration_id"`
+	Status                     IntegrationStatus    `json:"status"`
+	Error                      string               `json:"error,omitempty"`
 	AllResourceTypes           []string             `json:"all_resource_types"`
 	AllResourceTypesCount      int                  `json:"all_resource_types_count"`
 	ResourceTypeResults        []ResourceTypeResult `json:"resource_type_results"`
@@ -73,6 +162,25 @@ type ResourceTypeResult struct {
 	ResourceType  string `json:"resource_type"`
 	Error         string `json:"error"`
 	ResourceCount int    `json:"resource_count"`
+	// DeliveredCount is the number of resources the sink acknowledged, it
+	// is lower than ResourceCount when delivery partially failed.
+	DeliveredCount int `json:"delivered_count"`
+
+	StartedAt           time.Time `json:"started_at"`
+	FinishedAt          time.Time `json:"finished_at"`
+	DurationSeconds     float64   `json:"duration_seconds"`
+	Pages               int64     `json:"pages"`
+	APICalls            int64     `json:"api_calls"`
+	Retries             int64     `json:"retries"`
+	ThrottleWaitSeconds float64   `json:"throttle_wait_seconds"`
+	BytesSent           int64     `json:"bytes_sent"`
+	// SendBlockedSeconds is the time the describer waited on the sink, a
+	// high value means the sink is the bottleneck.
+	SendBlockedSeconds float64 `json:"send_blocked_seconds"`
+	// DeletedCount is the number of resources tombstoned, DeletionsSkipped
+	// the number the deletion guard kept although they were not described.
+	DeletedCount     int64 `json:"deleted_count"`
+	DeletionsSkipped int64 `json:"deletions_skipped"`
 }
 
 type ResourceType struct {
@@ -97,7 +205,7 @@ func (tr *TaskRunner) RunTask(ctx context.Context) error {
 
 	inventoryClient := coreClient.NewCoreServiceClient(tr.coreServiceEndpoint)
 	if _, ok := tr.request.TaskDefinition.Params["integrations_query"]; ok {
-		integrations, err = retryWithBackoff("GetIntegrations", func() ([]Integration, error) {
+		integrations, err = retry.Do(ctx, tr.retryPolicy, "GetIntegrations", func(ctx context.Context) ([]Integration, error) {
 			return GetIntegrationsFromQuery(inventoryClient, tr.request.TaskDefinition.Params)
 		})
 		if err != nil {
@@ -106,212 +214,511 @@ func (tr *TaskRunner) RunTask(ctx context.Context) error {
 		}
 	}
 
+	// The resource types are the same for every integration, they are
+	// resolved once instead of querying the core service per integration.
+	resourceTypes, err := tr.resolveResourceTypes(ctx)
+	if err != nil {
+		tr.logger.Error("Error fetching resource types", zap.Error(err))
+		return err
+	}
+
 	for _, i := range integrations {
 		taskResult.AllIntegrations = append(taskResult.AllIntegrations, i.IntegrationID)
 	}
 	taskResult.AllIntegrationsCount = len(integrations)
 	taskResult.ProgressedIntegrations = make(map[string]*IntegrationResult)
 
-	tr.logger.Info("Describing integrations", zap.Any("integrations", integrations))
+	tr.logger.Info("Describing integrations", zap.Any("integrations", integrations),
+		zap.Int("describe_concurrency", cap(tr.describeSlots)), zap.Int("integration_describe_concurrency", tr.integrationConcurrency),
+		zap.Int("max_concurrent_integrations", cap(tr.integrationSlots)))
 
-	for _, i := range integrations {
-		err = tr.describeIntegrationResourceTypes(ctx, i, taskResult)
-		if err != nil {
-			tr.logger.Error("Error describing integrations", zap.Error(err))
-			return err
-		}
-	}
+	progress := newProgressReporter(tr.jq, tr.logger, tr.request.TaskDefinition.RunID, taskResult, tr.response)
 
-	jsonBytes, err := json.Marshal(taskResult)
+	tr.checkpoints, err = newCheckpointStore(ctx, tr.jq, tr.request.TaskDefinition.RunID, tr.logger)
 	if err != nil {
-		err = fmt.Errorf("failed Marshaling task result: %s", err.Error())
-		return err
+		tr.logger.Warn("checkpointing disabled for this run", zap.Error(err))
+	} else if n := tr.checkpoints.count(); n > 0 {
+		tr.logger.Info("resuming task run from checkpoint", zap.Int("finished_resource_types", n))
 	}
-	tr.response.Result = jsonBytes
 
-	return nil
+	return tr.describeIntegrations(ctx, integrations, resourceTypes, progress)
 }
 
-func (tr *TaskRunner) describeIntegrationResourceTypes(ctx context.Context, i Integration, taskResult *TaskResult) error {
-	taskResult.ProgressedIntegrations[i.IntegrationID] = &IntegrationResult{
-		IntegrationID: i.IntegrationID,
+// describeIntegrations describes the integrations, at most
+// cap(integrationSlots) at once, and finalizes the task result. An abortError
+// of any integration cancels the others and is returned.
+func (tr *TaskRunner) describeIntegrations(ctx context.Context, integrations []Integration, resourceTypes []ResourceType, progress *progressReporter) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for _, i := range integrations {
+		if err := acquireSlot(runCtx, tr.integrationSlots); err != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i Integration) {
+			defer func() {
+				<-tr.integrationSlots
+				wg.Done()
+			}()
+			err := tr.describeIntegrationResourceTypes(runCtx, i, resourceTypes, progress)
+			if err != nil {
+				tr.logger.Error("Error describing integration", zap.String("integration_id", i.IntegrationID), zap.Error(err))
+			}
+
+			var abortErr abortError
+			if errors.As(err, &abortErr) {
+				errOnce.Do(func() {
+					firstErr = abortErr.error
+					cancel()
+				})
+				return
+			}
+			if pubErr := progress.finishIntegration(runCtx, i.IntegrationID, err); pubErr != nil {
+				errOnce.Do(func() {
+					firstErr = pubErr
+					cancel()
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if firstErr != nil {
+		return firstErr
 	}
-	taskResult.ProgressedIntegrationsCount++
 
-	var resourceTypes []ResourceType
-	var err error
+	return progress.finalize()
+}
+
+func (tr *TaskRunner) describeIntegrationResourceTypes(ctx context.Context, i Integration, resourceTypes []ResourceType, progress *progressReporter) error {
+	progress.startIntegration(i.IntegrationID)
 
-	config, err := tr.vaultSrc.Decrypt(ctx, i.Secret)
+	config, err := tr.credentialSrc.Decrypt(ctx, i.Secret)
 	if err != nil {
 		return fmt.Errorf("decrypt error: %w", err)
 	}
 
-	inventoryClient := coreClient.NewCoreServiceClient(tr.coreServiceEndpoint)
-	if _, ok := tr.request.TaskDefinition.Params["resource_types_query"]; ok {
-		resourceTypes, err = retryWithBackoff("GetResourceTypes", func() ([]ResourceType, error) {
-			return GetResourceTypesFromQuery(inventoryClient, tr.request.TaskDefinition.Params)
-		})
-		if err != nil {
-			tr.logger.Error("Error fetching integrations", zap.Error(err))
-			return err
-		}
-	}
-
 	tr.logger.Info("Describing integration", zap.String("integration_id", i.IntegrationID), zap.Any("resource_types", resourceTypes))
 
-	for _, rt := range resourceTypes {
-		taskResult.ProgressedIntegrations[i.IntegrationID].AllResourceTypes = append(taskResult.ProgressedIntegrations[i.IntegrationID].AllResourceTypes, rt.Name)
+	progress.setResourceTypes(i.IntegrationID, resourceTypes)
+
+	params := stringParams(tr.request.TaskDefinition.Params)
+	for k, v := range params {
+		ctx = context.WithValue(ctx, k, v)
 	}
-	taskResult.ProgressedIntegrations[i.IntegrationID].AllResourceTypesCount = len(resourceTypes)
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	integrationSlots := make(chan struct{}, tr.integrationConcurrency)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
 	for _, rt := range resourceTypes {
-		params := make(map[string]string)
-		for key, value := range tr.request.TaskDefinition.Params {
-			params[key] = fmt.Sprintf("%v", value)
+		if prev, ok := tr.checkpoints.get(i.IntegrationID, rt.Name); ok {
+			tr.logger.Info("skipping resource type finished before resume", zap.String("integration_id", i.IntegrationID), zap.String("resource_type", rt.Name))
+			if err := progress.finishResourceType(ctx, i.IntegrationID, prev); err != nil {
+				errOnce.Do(func() { firstErr = abortError{err} })
+				break
+			}
+			continue
+		}
+
+		if err := acquireSlot(ctx, integrationSlots); err != nil {
+			errOnce.Do(func() { firstErr = err })
+			break
 		}
-		for k, v := range params {
-			ctx = context.WithValue(ctx, k, v)
+		if err := acquireSlot(ctx, tr.describeSlots); err != nil {
+			<-integrationSlots
+			errOnce.Do(func() { firstErr = err })
+			break
 		}
 
-		job := describe.DescribeJob{
-			JobID:                  tr.request.TaskDefinition.RunID,
-			ResourceType:           rt.Name,
-			IntegrationID:          i.IntegrationID,
-			ProviderID:             i.ProviderID,
-			DescribedAt:            time.Now().Unix(),
-			IntegrationType:        integration.Type(i.IntegrationType),
-			CipherText:             i.Secret,
-			IntegrationLabels:      i.Labels,
-			IntegrationAnnotations: i.Annotations,
+		wg.Add(1)
+		go func(rt ResourceType) {
+			defer func() {
+				<-tr.describeSlots
+				<-integrationSlots
+				wg.Done()
+			}()
+			if err := tr.describeResourceType(ctx, i, rt, params, config, progress); err != nil {
+				errOnce.Do(func() {
+					firstErr = abortError{err}
+					cancel()
+				})
+			}
+		}(rt)
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+func (tr *TaskRunner) describeResourceType(ctx context.Context, i Integration, rt ResourceType, params map[string]string, config map[string]any, progress *progressReporter) error {
+	job := describe.DescribeJob{
+		JobID:                  tr.request.TaskDefinition.RunID,
+		ResourceType:           rt.Name,
+		IntegrationID:          i.IntegrationID,
+		ProviderID:             i.ProviderID,
+		DescribedAt:            time.Now().Unix(),
+		IntegrationType:        integration.Type(i.IntegrationType),
+		CipherText:             i.Secret,
+		IntegrationLabels:      i.Labels,
+		IntegrationAnnotations: i.Annotations,
+	}
+
+	startedAt := time.Now()
+	stats := model.NewDescribeStats()
+
+	timeout := tr.describeTimeout(rt.Name)
+	describeCtx, cancel := context.WithTimeoutCause(describers.WithStats(ctx, stats), timeout, errDescribeTimeout)
+	defer cancel()
+
+	policy := tr.retryPolicy
+	onRetry := policy.OnRetry
+	policy.OnRetry = func(operation string, attempt int, err error, delay time.Duration) {
+		stats.AddRetry()
+		if onRetry != nil {
+			onRetry(operation, attempt, err, delay)
 		}
-		resources, err := orchestrator.Describe(ctx, tr.logger, job, params, config, tr.request.EsDeliverEndpoint,
-			tr.request.IngestionPipelineEndpoint, tr.describeToken, tr.request.UseOpenSearch)
-		errMsg := ""
-		if err != nil {
+	}
+	resources, err := retry.Do(describeCtx, policy, fmt.Sprintf("Describe %s", rt.Name), func(ctx context.Context) ([]string, error) {
+		return tr.describe(ctx, job, params, config)
+	})
+	errMsg := ""
+	resourceCount, deliveredCount := len(resources), len(resources)
+	var deliveryErr *orchestrator.DeliveryError
+	if errors.As(err, &deliveryErr) {
+		tr.logger.Error("Resources were only partially delivered", zap.String("resource_type", rt.Name), zap.Error(err))
+		resourceCount, deliveredCount = deliveryErr.Described, deliveryErr.Delivered
+		errMsg = err.Error()
+	} else if err != nil {
+		if errors.Is(context.Cause(describeCtx), errDescribeTimeout) && ctx.Err() == nil {
+			tr.logger.Error("Describing job timed out", zap.String("resource_type", rt.Name), zap.Duration("timeout", timeout), zap.Error(err))
+			errMsg = describeTimeoutError
+		} else {
 			tr.logger.Error("Error describing job", zap.Error(err))
 			errMsg = err.Error()
 		}
-		taskResult.ProgressedIntegrations[i.IntegrationID].ResourceTypeResults = append(
-			taskResult.ProgressedIntegrations[i.IntegrationID].ResourceTypeResults,
-			ResourceTypeResult{
-				ResourceType:  rt.Name,
-				Error:         errMsg,
-				ResourceCount: len(resources),
-			})
-
-		taskResult.ProgressedIntegrations[i.IntegrationID].FinishedResourceTypesCount = len(taskResult.ProgressedIntegrations[i.IntegrationID].ResourceTypeResults)
-		jsonBytes, err := json.Marshal(taskResult)
+	}
+
+	finishedAt := time.Now()
+	snapshot := stats.Snapshot()
+	result := ResourceTypeResult{
+		ResourceType:   rt.Name,
+		Error:          errMsg,
+		ResourceCount:  resourceCount,
+		DeliveredCount: deliveredCount,
+
+		StartedAt:           startedAt,
+		FinishedAt:          finishedAt,
+		DurationSeconds:     finishedAt.Sub(startedAt).Seconds(),
+		Pages:               snapshot.Pages,
+		APICalls:            snapshot.APICalls,
+		Retries:             snapshot.Retries,
+		ThrottleWaitSeconds: snapshot.ThrottleWait.Seconds(),
+		BytesSent:           snapshot.BytesSent,
+		SendBlockedSeconds:  snapshot.SendBlocked.Seconds(),
+		DeletedCount:        snapshot.Deleted,
+		DeletionsSkipped:    snapshot.DeletionsSkipped,
+	}
+	if err = tr.checkpoints.save(ctx, i.IntegrationID, result); err != nil {
+		tr.logger.Warn("failed to checkpoint resource type", zap.String("integration_id", i.IntegrationID), zap.String("resource_type", rt.Name), zap.Error(err))
+	}
+	if err = progress.finishResourceType(ctx, i.IntegrationID, result); err != nil {
+		return err
+	}
+	tr.logger.Info("describing resource type finished", zap.String("integration_id", i.IntegrationID), zap.String("resource_type", rt.Name),
+		zap.Duration("duration", finishedAt.Sub(startedAt)), zap.Int64("api_calls", snapshot.APICalls), zap.Int64("bytes_sent", snapshot.BytesSent))
+
+	return nil
+}
+
+// describeJob describes job into the sink of the task request.
+func (tr *TaskRunner) describeJob(ctx context.Context, job describe.DescribeJob, params map[string]string, config map[string]any) ([]string, error) {
+	return orchestrator.Describe(ctx, tr.logger, job, params, config, tr.request.EsDeliverEndpoint,
+		tr.request.IngestionPipelineEndpoint, tr.describeToken, tr.request.UseOpenSearch, tr.describeOptions()...)
+}
+
+func (tr *TaskRunner) describeOptions() []orchestrator.DescribeOption {
+	var opts []orchestrator.DescribeOption
+	if tr.stateStore != nil {
+		opts = append(opts, orchestrator.WithResourceStateStore(tr.stateStore))
+	}
+	// Deleting documents is opt-in, with the indexed resources as the known
+	// ones when es is reachable.
+	if boolParam(tr.request.TaskDefinition.Params, "deletion_detection", false) {
+		opts = append(opts, orchestrator.WithDeletionDetection())
+		if tr.esClient != nil {
+			opts = append(opts, orchestrator.WithIndexedResources(tr.esClient))
+		}
+	}
+	return opts
+}
+
+// describeTimeout returns the deadline of a single resource type: the
+// describe_timeout annotation of the resource type, else the describe_timeout
+// task param, else defaultDescribeTimeout.
+func (tr *TaskRunner) describeTimeout(resourceType string) time.Duration {
+	if rt, err := orchestrator.GetResourceType(resourceType); err == nil {
+		if d, ok := durationValue(rt.Annotations[describeTimeoutKey]); ok && d > 0 {
+			return d
+		}
+	}
+	if d, ok := durationValue(tr.request.TaskDefinition.Params[describeTimeoutKey]); ok && d > 0 {
+		return d
+	}
+	return defaultDescribeTimeout
+}
+
+// resolveResourceTypes returns the resource types to describe. They come from
+// the resource_types_query param when it is set, otherwise from every supported
+// resource type as soon as resource_types_include or resource_types_exclude is
+// given. Both pattern params also filter the query result.
+func (tr *TaskRunner) resolveResourceTypes(ctx context.Context) ([]ResourceType, error) {
+	params := tr.request.TaskDefinition.Params
+	include := listParam(params, "resource_types_include")
+	exclude := listParam(params, "resource_types_exclude")
+
+	var names []string
+	if _, ok := params["resource_types_query"]; ok {
+		inventoryClient := coreClient.NewCoreServiceClient(tr.coreServiceEndpoint)
+		resourceTypes, err := retry.Do(ctx, tr.retryPolicy, "GetResourceTypes", func(ctx context.Context) ([]ResourceType, error) {
+			return GetResourceTypesFromQuery(inventoryClient, params)
+		})
 		if err != nil {
-			err = fmt.Errorf("failed Marshaling task result: %s", err.Error())
-			return err
+			return nil, err
 		}
-		tr.response.Result = jsonBytes
-		responseJson, marshalErr := json.Marshal(tr.response)
-		if marshalErr != nil {
-			tr.logger.Error("failed to create final job result json", zap.Error(marshalErr))
-			return marshalErr
+		if len(include) == 0 && len(exclude) == 0 {
+			return resourceTypes, nil
 		}
-		msgId := fmt.Sprintf("task-run-result-%d", tr.request.TaskDefinition.RunID)
-		if _, err = tr.jq.Produce(ctx, envs.ResultTopicName, responseJson, msgId); err != nil { // Use original ctx
-			tr.logger.Error("failed to publish initial InProgress job status", zap.String("response", string(responseJson)), zap.Error(err))
-			return err
+		for _, rt := range resourceTypes {
+			names = append(names, rt.Name)
 		}
-		tr.logger.Info("describing resource type finished", zap.String("integration_id", i.IntegrationID), zap.String("resource_type", rt.Name))
+	} else if len(include) > 0 || len(exclude) > 0 {
+		names = orchestrator.ListResourceTypes()
+	} else {
+		return nil, nil
 	}
 
-	return nil
+	names, err := orchestrator.FilterResourceTypes(names, include, exclude)
+	if err != nil {
+		return nil, err
+	}
+	resourceTypes := make([]ResourceType, 0, len(names))
+	for _, name := range names {
+		resourceTypes = append(resourceTypes, ResourceType{Name: name})
+	}
+	return resourceTypes, nil
+}
+
+// abortError marks failures that are not specific to a single integration,
+// such as being unable to publish progress, and therefore abort the whole run.
+type abortError struct {
+	error
+}
+
+func (e abortError) Unwrap() error {
+	return e.error
+}
+
+// FinishedWithErrorsError is returned by RunTask when every integration was
+// processed but some of them failed or were only partially described.
+type FinishedWithErrorsError struct {
+	TotalIntegrations   int
+	FailedIntegrations  map[string]string
+	PartialIntegrations map[string]string
+}
+
+func (e *FinishedWithErrorsError) Error() string {
+	var details []string
+	for _, id := range sortedKeys(e.FailedIntegrations) {
+		details = append(details, fmt.Sprintf("%s failed: %s", id, e.FailedIntegrations[id]))
+	}
+	for _, id := range sortedKeys(e.PartialIntegrations) {
+		details = append(details, fmt.Sprintf("%s partial: %s", id, e.PartialIntegrations[id]))
+	}
+	if len(details) > maxReportedFailures {
+		details = append(details[:maxReportedFailures], fmt.Sprintf("and %d more", len(details)-maxReportedFailures))
+	}
+	return fmt.Sprintf("finished with errors: %d of %d integrations failed, %d partially failed (%s)",
+		len(e.FailedIntegrations), e.TotalIntegrations, len(e.PartialIntegrations), strings.Join(details, "; "))
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// acquireSlot takes a slot from a semaphore channel, giving up when ctx is done.
+func acquireSlot(ctx context.Context, slots chan struct{}) error {
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func GetIntegrationsFromQuery(coreServiceClient coreClient.CoreServiceClient, params map[string]any) ([]Integration, error) {
-	if v, ok := params["integrations_query"]; ok {
-		if vv, ok := v.(string); !ok {
-			return nil, fmt.Errorf("query id should be a string")
-		} else {
-			queryResponse, err := coreServiceClient.RunQuery(&httpclient.Context{UserRole: authApi.AdminRole}, coreApi.RunQueryRequest{
-				Query: &vv,
-				Page: coreApi.Page{
-					No:   1,
-					Size: 1000,
-				},
-			})
-			if err != nil {
-				return nil, err
+	query, err := queryParam(params, "integrations_query")
+	if err != nil {
+		return nil, err
+	}
+
+	var integrations []Integration
+	err = runPagedQuery(coreServiceClient, query, intParam(params, "query_page_size", defaultQueryPageSize), intParam(params, "query_max_rows", defaultQueryMaxRows), func(headers []string, r []any) {
+		integ := Integration{
+			Annotations: make(map[string]string),
+			Labels:      make(map[string]string),
+		}
+		for i, rc := range r {
+			if i >= len(headers) {
+				break
 			}
-			var integrations []Integration
-			for _, r := range queryResponse.Result {
-				integ := Integration{
-					Annotations: make(map[string]string),
-					Labels:      make(map[string]string),
-				}
-				for i, rc := range r {
-					switch queryResponse.Headers[i] {
-					case "integration_id":
-						integ.IntegrationID = rc.(string)
-					case "provider_id":
-						integ.ProviderID = rc.(string)
-					case "integration_type":
-						integ.IntegrationType = rc.(string)
-					case "secret":
-						integ.Secret = rc.(string)
-					case "annotations":
-						if rc != nil {
-							if obj, ok := rc.(map[string]interface{}); ok {
-								for k, v := range obj {
-									if vStr, ok := v.(string); ok {
-										integ.Annotations[k] = vStr
-									}
-								}
-							}
+			switch headers[i] {
+			case "integration_id":
+				integ.IntegrationID = cellString(rc)
+			case "provider_id":
+				integ.ProviderID = cellString(rc)
+			case "integration_type":
+				integ.IntegrationType = cellString(rc)
+			case "secret":
+				integ.Secret = cellString(rc)
+			case "annotations":
+				if obj, ok := rc.(map[string]interface{}); ok {
+					for k, v := range obj {
+						if vStr, ok := v.(string); ok {
+							integ.Annotations[k] = vStr
 						}
-					case "labels":
-						if rc != nil {
-							if obj, ok := rc.(map[string]interface{}); ok {
-								for k, v := range obj {
-									if vStr, ok := v.(string); ok {
-										integ.Labels[k] = vStr
-									}
-								}
-							}
+					}
+				}
+			case "labels":
+				if obj, ok := rc.(map[string]interface{}); ok {
+					for k, v := range obj {
+						if vStr, ok := v.(string); ok {
+							integ.Labels[k] = vStr
 						}
 					}
 				}
-				integrations = append(integrations, integ)
 			}
-			return integrations, nil
 		}
-	} else {
-		return nil, fmt.Errorf("query id should be a string")
+		integrations = append(integrations, integ)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return integrations, nil
 }
 
 func GetResourceTypesFromQuery(coreServiceClient coreClient.CoreServiceClient, params map[string]any) ([]ResourceType, error) {
-	if v, ok := params["resource_types_query"]; ok {
-		if vv, ok := v.(string); !ok {
-			return nil, fmt.Errorf("query id should be a string")
-		} else {
-			queryResponse, err := coreServiceClient.RunQuery(&httpclient.Context{UserRole: authApi.AdminRole}, coreApi.RunQueryRequest{
-				Query: &vv,
-				Page: coreApi.Page{
-					No:   1,
-					Size: 1000,
-				},
-			})
-			if err != nil {
-				return nil, err
-			}
-			var resourceTypes []ResourceType
-			for _, r := range queryResponse.Result {
-				resourceType := ResourceType{}
-				for i, rc := range r {
-					if queryResponse.Headers[i] == "resource_type" {
-						resourceType.Name = rc.(string)
-					}
-				}
-				resourceTypes = append(resourceTypes, resourceType)
+	query, err := queryParam(params, "resource_types_query")
+	if err != nil {
+		return nil, err
+	}
+
+	var resourceTypes []ResourceType
+	err = runPagedQuery(coreServiceClient, query, intParam(params, "query_page_size", defaultQueryPageSize), intParam(params, "query_max_rows", defaultQueryMaxRows), func(headers []string, r []any) {
+		resourceType := ResourceType{}
+		for i, rc := range r {
+			if i < len(headers) && headers[i] == "resource_type" {
+				resourceType.Name = cellString(rc)
 			}
-			return resourceTypes, nil
 		}
-	} else {
-		return nil, fmt.Errorf("query id should be a string")
+		resourceTypes = append(resourceTypes, resourceType)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resourceTypes, nil
+}
+
+func queryParam(params map[string]any, key string) (string, error) {
+	v, ok := params[key]
+	if !ok {
+		return "", fmt.Errorf("%s param is missing", key)
+	}
+	query, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("query id should be a string")
+	}
+	return query, nil
+}
+
+// queryRunner runs core service queries, it is implemented by
+// coreClient.CoreServiceClient.
+type queryRunner interface {
+	RunQuery(ctx *httpclient.Context, req coreApi.RunQueryRequest) (*coreApi.RunQueryResponse, error)
+}
+
+// runPagedQuery runs a core service query page by page until a page comes back
+// short or empty. It fails instead of truncating when the result has more than
+// maxRows rows.
+func runPagedQuery(runner queryRunner, query string, pageSize, maxRows int, handle func(headers []string, row []any)) error {
+	if pageSize <= 0 {
+		pageSize = defaultQueryPageSize
+	}
+	if maxRows <= 0 {
+		maxRows = defaultQueryMaxRows
+	}
+
+	rows := 0
+	for page := 1; ; page++ {
+		queryResponse, err := runner.RunQuery(&httpclient.Context{UserRole: authApi.AdminRole}, coreApi.RunQueryRequest{
+			Query: &query,
+			Page: coreApi.Page{
+				No:   page,
+				Size: pageSize,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if queryResponse == nil || len(queryResponse.Result) == 0 {
+			return nil
+		}
+		if rows+len(queryResponse.Result) > maxRows {
+			return fmt.Errorf("query returned more than %d rows, refusing to continue", maxRows)
+		}
+		for _, r := range queryResponse.Result {
+			handle(queryResponse.Headers, r)
+		}
+		rows += len(queryResponse.Result)
+
+		if len(queryResponse.Result) < pageSize {
+			return nil
+		}
+	}
+}
+
+// cellString renders a query result cell as a string. Ids may come back as
+// numbers depending on the query, so non-string cells are formatted instead of
+// being rejected.
+func cellString(v any) string {
+	switch vv := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return vv
+	case float64:
+		return strconv.FormatFloat(vv, 'f', -1, 64)
+	case json.Number:
+		return vv.String()
+	default:
+		return fmt.Sprintf("%v", vv)
 	}
 }
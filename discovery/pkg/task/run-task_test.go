@@ -0,0 +1,272 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opengovern/og-describer-template/discovery/pkg/retry"
+	"github.com/opengovern/og-util/pkg/describe"
+	"github.com/opengovern/og-util/pkg/httpclient"
+	"github.com/opengovern/og-util/pkg/tasks"
+	coreApi "github.com/opengovern/opensecurity/services/core/api"
+	"github.com/opengovern/opensecurity/services/tasks/scheduler"
+	"go.uber.org/zap"
+)
+
+// fakeCredentials fails to decrypt the "bad" secret.
+type fakeCredentials struct{}
+
+func (fakeCredentials) Decrypt(_ context.Context, cipherText string) (map[string]any, error) {
+	if cipherText == "bad" {
+		return nil, errors.New("invalid secret")
+	}
+	return map[string]any{}, nil
+}
+
+type describeFunc func(ctx context.Context, job describe.DescribeJob, params map[string]string, config map[string]any) ([]string, error)
+
+func newTestRunner(describe describeFunc, describeConcurrency, integrationConcurrency, maxIntegrations int) *TaskRunner {
+	return &TaskRunner{
+		credentialSrc: fakeCredentials{},
+		logger:        zap.NewNop(),
+		request: tasks.TaskRequest{
+			TaskDefinition: tasks.TaskDefinition{RunID: 1, Params: map[string]any{}},
+		},
+		response:               &scheduler.TaskResponse{},
+		describeSlots:          make(chan struct{}, describeConcurrency),
+		integrationConcurrency: integrationConcurrency,
+		integrationSlots:       make(chan struct{}, maxIntegrations),
+		retryPolicy:            retry.Policy{MaxAttempts: 1},
+		describe:               describe,
+	}
+}
+
+func testIntegrations(n int) []Integration {
+	integrations := make([]Integration, 0, n)
+	for i := 0; i < n; i++ {
+		integrations = append(integrations, Integration{IntegrationID: fmt.Sprintf("integration-%d", i)})
+	}
+	return integrations
+}
+
+func testResourceTypes(n int) []ResourceType {
+	resourceTypes := make([]ResourceType, 0, n)
+	for i := 0; i < n; i++ {
+		resourceTypes = append(resourceTypes, ResourceType{Name: fmt.Sprintf("Github/Type%d", i)})
+	}
+	return resourceTypes
+}
+
+func runIntegrations(tr *TaskRunner, pub publisher, integrations []Integration, resourceTypes []ResourceType) (*TaskResult, error) {
+	result := &TaskResult{
+		AllIntegrationsCount:   len(integrations),
+		ProgressedIntegrations: make(map[string]*IntegrationResult),
+	}
+	progress := newProgressReporter(pub, tr.logger, 1, result, tr.response)
+	err := tr.describeIntegrations(context.Background(), integrations, resourceTypes, progress)
+	return result, err
+}
+
+// concurrency tracks the running describes, overall and per integration.
+type concurrency struct {
+	mu             sync.Mutex
+	running        int
+	max            int
+	perIntegration map[string]int
+	maxIntegration int
+	described      atomic.Int64
+}
+
+func (c *concurrency) describe(ctx context.Context, job describe.DescribeJob, _ map[string]string, _ map[string]any) ([]string, error) {
+	c.mu.Lock()
+	c.running++
+	c.max = max(c.max, c.running)
+	c.perIntegration[job.IntegrationID]++
+	c.maxIntegration = max(c.maxIntegration, c.perIntegration[job.IntegrationID])
+	c.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	c.mu.Lock()
+	c.running--
+	c.perIntegration[job.IntegrationID]--
+	c.mu.Unlock()
+	c.described.Add(1)
+	return []string{job.ResourceType}, nil
+}
+
+func TestDescribeIntegrationsBoundsConcurrency(t *testing.T) {
+	tests := []struct {
+		name                   string
+		describeConcurrency    int
+		integrationConcurrency int
+	}{
+		{name: "describe slots", describeConcurrency: 2, integrationConcurrency: 10},
+		{name: "integration slots", describeConcurrency: 10, integrationConcurrency: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &concurrency{perIntegration: make(map[string]int)}
+			tr := newTestRunner(c.describe, tt.describeConcurrency, tt.integrationConcurrency, 3)
+			pub := &fakePublisher{}
+			if _, err := runIntegrations(tr, pub, testIntegrations(3), testResourceTypes(4)); err != nil {
+				t.Fatal(err)
+			}
+			if got := c.described.Load(); got != 12 {
+				t.Errorf("described %d resource types, want 12", got)
+			}
+			if c.max > tt.describeConcurrency {
+				t.Errorf("%d describes ran at once, want at most %d", c.max, tt.describeConcurrency)
+			}
+			if c.maxIntegration > tt.integrationConcurrency {
+				t.Errorf("%d describes of an integration ran at once, want at most %d", c.maxIntegration, tt.integrationConcurrency)
+			}
+
+			// Progress goes out in the order resource types finish, one more
+			// with every message, then once per finished integration.
+			finished := 0
+			for i, result := range pub.published() {
+				n := finishedResourceTypes(result)
+				if n < finished || n > finished+1 {
+					t.Fatalf("message %d has %d finished resource types after %d", i, n, finished)
+				}
+				finished = n
+			}
+			if finished != 12 {
+				t.Errorf("last message has %d finished resource types, want 12", finished)
+			}
+		})
+	}
+}
+
+func TestDescribeIntegrationsClassifiesResults(t *testing.T) {
+	describe := func(_ context.Context, job describe.DescribeJob, _ map[string]string, _ map[string]any) ([]string, error) {
+		switch {
+		case job.IntegrationID == "failed",
+			job.IntegrationID == "partial" && job.ResourceType == "Github/Type0":
+			return nil, errors.New("boom")
+		}
+		return []string{job.ResourceType}, nil
+	}
+	tr := newTestRunner(describe, 4, 2, 4)
+	integrations := []Integration{
+		{IntegrationID: "succeeded"},
+		{IntegrationID: "partial"},
+		{IntegrationID: "failed"},
+		{IntegrationID: "undecryptable", Secret: "bad"},
+	}
+	result, err := runIntegrations(tr, &fakePublisher{}, integrations, testResourceTypes(2))
+
+	var ferr *FinishedWithErrorsError
+	if !errors.As(err, &ferr) {
+		t.Fatalf("describeIntegrations() = %v, want a FinishedWithErrorsError", err)
+	}
+	want := map[string]IntegrationStatus{
+		"succeeded":     IntegrationStatusSucceeded,
+		"partial":       IntegrationStatusPartial,
+		"failed":        IntegrationStatusFailed,
+		"undecryptable": IntegrationStatusFailed,
+	}
+	for id, status := range want {
+		if got := result.ProgressedIntegrations[id].Status; got != status {
+			t.Errorf("%s status %s, want %s", id, got, status)
+		}
+	}
+	if len(ferr.FailedIntegrations) != 2 || len(ferr.PartialIntegrations) != 1 {
+		t.Errorf("%d failed and %d partial integrations, want 2 and 1", len(ferr.FailedIntegrations), len(ferr.PartialIntegrations))
+	}
+}
+
+func TestDescribeIntegrationsAbortsOnPublishFailure(t *testing.T) {
+	// Publishing the first progress fails, the run stops and the describes
+	// still running are cancelled.
+	var cancelled atomic.Int64
+	started := make(chan struct{})
+	describe := func(ctx context.Context, job describe.DescribeJob, _ map[string]string, _ map[string]any) ([]string, error) {
+		if job.IntegrationID == "integration-0" {
+			<-started
+			return []string{job.ResourceType}, nil
+		}
+		close(started)
+		select {
+		case <-ctx.Done():
+			cancelled.Add(1)
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil, errors.New("describe was not cancelled")
+		}
+	}
+	tr := newTestRunner(describe, 4, 1, 2)
+	pub := &fakePublisher{failAt: 1}
+
+	start := time.Now()
+	_, err := runIntegrations(tr, pub, testIntegrations(2), testResourceTypes(1))
+	if err == nil || err.Error() != "nats unavailable" {
+		t.Fatalf("describeIntegrations() = %v, want the publish error", err)
+	}
+	var ferr *FinishedWithErrorsError
+	if errors.As(err, &ferr) {
+		t.Error("an aborted run must not be reported as finished")
+	}
+	if cancelled.Load() != 1 {
+		t.Errorf("%d running describes cancelled, want 1", cancelled.Load())
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("the run waited for the other integration instead of cancelling it")
+	}
+}
+
+// fakeQuery serves rows query results, page by page.
+type fakeQuery struct {
+	rows  int
+	pages int
+}
+
+func (q *fakeQuery) RunQuery(_ *httpclient.Context, req coreApi.RunQueryRequest) (*coreApi.RunQueryResponse, error) {
+	q.pages++
+	resp := &coreApi.RunQueryResponse{Headers: []string{"n"}}
+	for i := (req.Page.No - 1) * req.Page.Size; i < q.rows && i < req.Page.No*req.Page.Size; i++ {
+		resp.Result = append(resp.Result, []any{float64(i)})
+	}
+	return resp, nil
+}
+
+func TestRunPagedQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		rows      int
+		pageSize  int
+		maxRows   int
+		wantRows  int
+		wantPages int
+		wantErr   bool
+	}{
+		{name: "short page", rows: 5, pageSize: 3, maxRows: 10, wantRows: 5, wantPages: 2},
+		{name: "ends with an empty page", rows: 6, pageSize: 3, maxRows: 10, wantRows: 6, wantPages: 3},
+		{name: "exactly the cap", rows: 6, pageSize: 3, maxRows: 6, wantRows: 6, wantPages: 3},
+		{name: "over the cap", rows: 7, pageSize: 3, maxRows: 6, wantRows: 6, wantErr: true},
+		{name: "cap within a page", rows: 6, pageSize: 3, maxRows: 4, wantRows: 3, wantErr: true},
+		{name: "no rows", rows: 0, pageSize: 3, maxRows: 6, wantPages: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &fakeQuery{rows: tt.rows}
+			rows := 0
+			err := runPagedQuery(q, "query", tt.pageSize, tt.maxRows, func([]string, []any) { rows++ })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runPagedQuery() error = %v, want error %v", err, tt.wantErr)
+			}
+			if rows != tt.wantRows {
+				t.Errorf("handled %d rows, want %d", rows, tt.wantRows)
+			}
+			if !tt.wantErr && q.pages != tt.wantPages {
+				t.Errorf("fetched %d pages, want %d", q.pages, tt.wantPages)
+			}
+		})
+	}
+}
@@ -19,6 +19,10 @@ import (
 	"time"
 )
 
+// errWorkerShutdown is returned by ProcessMessage when the worker stopped
+// before the task run finished.
+var errWorkerShutdown = errors.New("worker shut down before the task run finished")
+
 type Worker struct {
 	logger   *zap.Logger
 	jq       *jq.JobQueue
@@ -82,6 +86,14 @@ func (w *Worker) Run(ctx context.Context) error {
 		w.logger.Info("received a new job")
 
 		err := w.ProcessMessage(ctx, msg)
+		if errors.Is(err, errWorkerShutdown) {
+			// The run is redelivered and resumes from its checkpoints.
+			w.logger.Warn("task run interrupted by shutdown, handing it back", zap.Error(err))
+			if nakErr := msg.Nak(); nakErr != nil {
+				w.logger.Error("failed to send the nak message", zap.Error(nakErr))
+			}
+			return
+		}
 		if err != nil {
 			// Log error from ProcessMessage itself (e.g., initial setup failure)
 			// Note: Errors during task.RunTask are handled within ProcessMessage's defer
@@ -149,19 +161,27 @@ func (w *Worker) ProcessMessage(ctx context.Context, msg jetstream.Msg) (err err
 	}
 
 	defer func() {
+		if err != nil && ctx.Err() != nil {
+			// No final result: it would fail the run, and share its message
+			// id with the result of the redelivered run.
+			err = fmt.Errorf("%w: %w", errWorkerShutdown, err)
+			return
+		}
+
 		finalStatus := models.TaskRunStatusFinished
 		failureMsg := ""
 
-		if err != nil {
-			if errors.Is(err, context.Canceled) {
-				if ctxWithCancel.Err() == context.Canceled {
-					finalStatus = models.TaskRunStatusCancelled
-					msgLogger.Warn("Job execution was cancelled", zap.Error(err))
-				} else {
-					finalStatus = models.TaskRunStatusFailed
-					failureMsg = "Task run cancelled (worker shutdown?)"
-					msgLogger.Warn("Job execution cancelled by parent context", zap.Error(err))
-				}
+		var finishedWithErrors *task.FinishedWithErrorsError
+		if errors.As(err, &finishedWithErrors) {
+			// Every integration was processed, the failures are summarised
+			// here and detailed per integration in the task result.
+			finalStatus = models.TaskRunStatusFinished
+			failureMsg = finishedWithErrors.Error()
+			msgLogger.Warn("Task execution finished with errors", zap.Error(err))
+		} else if err != nil {
+			if errors.Is(err, context.Canceled) && ctxWithCancel.Err() == context.Canceled {
+				finalStatus = models.TaskRunStatusCancelled
+				msgLogger.Warn("Job execution was cancelled", zap.Error(err))
 			} else {
 				finalStatus = models.TaskRunStatusFailed
 				failureMsg = err.Error()
@@ -1,26 +1,34 @@
 package provider
 
 import (
+	"net/http"
 
 	model "github.com/opengovern/og-describer-template/discovery/pkg/models"
 	"github.com/opengovern/og-util/pkg/describe/enums"
 	"golang.org/x/net/context"
 )
 
-
+// Client is handed to the describer functions. Its HTTPClient counts the API
+// calls and rate limit waits of the describe, see models.StatsTransport.
 type Client struct {
-	
+	HTTPClient *http.Client
+}
+
+// NewClient TODO: authorize the client with the integration credentials, keeping
+// models.StatsTransport as the outermost transport.
+func NewClient(cfg model.IntegrationCredentials) Client {
+	return Client{HTTPClient: model.NewStatsHTTPClient()}
 }
 
-// DescribeByIntegration TODO: implement a wrapper to pass integration authorization to describer functions
+// DescribeByIntegration TODO: pass the integration parameters the describer functions need
 func DescribeByIntegration(describe func(context.Context, Client, string, *model.StreamSender) ([]model.Resource, error)) model.ResourceDescriber {
 	return func(ctx context.Context, cfg model.IntegrationCredentials, triggerType enums.DescribeTriggerType, additionalParameters map[string]string, stream *model.StreamSender) ([]model.Resource, error) {
-		var values []model.Resource
-		return values, nil
+		return describe(ctx, NewClient(cfg), additionalParameters["param"], stream)
 	}
 }
 
-// DescribeByIntegration TODO: implement a wrapper to pass integration authorization to describer functions
+// DescribeByIntegration TODO: implement a wrapper to pass integration authorization to describer functions,
+// with a client built by NewClient
 func DescribeSingleByRepo(describe func(context.Context, Client, string, string, string, *model.StreamSender) (*model.Resource, error)) model.SingleResourceDescriber {
 	return func(ctx context.Context, cfg model.IntegrationCredentials, triggerType enums.DescribeTriggerType, additionalParameters map[string]string, resourceID string, stream *model.StreamSender) (*model.Resource, error) {
 		var result *model.Resource
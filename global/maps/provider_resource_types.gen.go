@@ -20,6 +20,12 @@ var ResourceTypes = map[string]model.ResourceType{
         },
 		ListDescriber:        provider.DescribeByIntegration(describers.ListType),
 		GetDescriber:         nil,
+		Redactions:           []model.RedactionRule{
+            {Field: "DockerfileContent", Pattern: "(?i)\\b\\w*(?:TOKEN|PASSWORD|PASSWD|SECRET|KEY)\\w*=(?P<secret>\"(?:[^\"\\\\\\n]|\\\\.)*\"|'[^'\\n]*'|[^\\s\"']\\S*)", Action: "mask"},
+            {Field: "DockerfileContent", Pattern: "(?im)^[ \\t]*(?:ENV|ARG)[ \\t]+\\w*(?:TOKEN|PASSWORD|PASSWD|SECRET|KEY)\\w*[ \\t]+(?P<secret>[^\\n]*[^\\s])", Action: "mask"},
+            {Field: "DockerfileContentBase64", Pattern: "", Action: "hash"},
+        },
+		
 	},
 }
 